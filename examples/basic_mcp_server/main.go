@@ -1,47 +1,77 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/gavinvolpe/nexus/pkg/impl"
-	"github.com/gavinvolpe/nexus/pkg/types"
+	"github.com/gavinvolpe/nexus/internal/mcp"
+	"github.com/gavinvolpe/nexus/internal/models"
 )
 
-func main() {
-	// Create configuration
-	config := &types.Config{
-		Provider: "groq",
-		ModelID:  "mixtral-8x7b-32768",
-		APIKey:   os.Getenv("NEXUS_API_KEY"),
+// calculatorArgs are the arguments accepted by the calculator tool
+type calculatorArgs struct {
+	Operation string    `json:"operation" enum:"add,subtract,multiply,divide" description:"The operation to perform"`
+	Numbers   []float64 `json:"numbers" description:"The numbers to operate on"`
+}
+
+// calculatorResult is the output of the calculator tool
+type calculatorResult struct {
+	Result float64 `json:"result"`
+}
+
+func calculate(ctx context.Context, args calculatorArgs) (calculatorResult, error) {
+	if len(args.Numbers) == 0 {
+		return calculatorResult{}, fmt.Errorf("at least one number is required")
 	}
 
-	// Initialize model
-	model, err := impl.NewModel(config)
-	if err != nil {
-		log.Fatal(err)
+	result := args.Numbers[0]
+	for _, n := range args.Numbers[1:] {
+		switch args.Operation {
+		case "add":
+			result += n
+		case "subtract":
+			result -= n
+		case "multiply":
+			result *= n
+		case "divide":
+			if n == 0 {
+				return calculatorResult{}, fmt.Errorf("division by zero")
+			}
+			result /= n
+		default:
+			return calculatorResult{}, fmt.Errorf("unknown operation %q", args.Operation)
+		}
 	}
 
-	// Register tools
-	model.RegisterTool(&types.Tool{
-		Name:        "calculator",
-		Description: "Performs basic arithmetic operations",
-		Parameters: map[string]interface{}{
-			"operation": map[string]string{
-				"type":        "string",
-				"description": "The operation to perform (add, subtract, multiply, divide)",
-			},
-			"numbers": map[string]interface{}{
-				"type":        "array",
-				"items":       map[string]string{"type": "number"},
-				"description": "The numbers to operate on",
-			},
-		},
-	})
+	return calculatorResult{Result: result}, nil
+}
+
+func main() {
+	mixin := models.NewMCPModelMixin()
 
 	// Start MCP server
 	log.Println("Starting MCP server on :8080...")
-	if err := model.StartMCPServer(":8080"); err != nil {
+	if err := mixin.StartMCPServer(":8080"); err != nil {
+		log.Fatal(err)
+	}
+
+	// Register tools. The schema is derived from calculatorArgs.
+	calculator := mcp.NewFuncTool("calculator", "Performs basic arithmetic operations", calculate)
+	if err := mixin.RegisterMCPTool(calculator.Tool, calculator.Handler); err != nil {
+		log.Fatal(err)
+	}
+
+	// Serve until interrupted
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Println("Stopping MCP server...")
+	if err := mixin.StopMCPServer(); err != nil {
 		log.Fatal(err)
 	}
 }
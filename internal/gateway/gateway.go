@@ -0,0 +1,410 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package gateway serves the tools, resources and prompts of several
+// upstream MCP servers through a single mcp.Server.
+//
+// Tools and prompts are namespaced by the name their upstream was added
+// under, so the upstream tool diff added as git is exposed as git.diff.
+// Resource URIs are kept as they are and reads are routed to the upstream
+// that serves the URI.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gavinvolpe/nexus/internal/mcp"
+)
+
+// Separator joins an upstream's name to the names of its tools and prompts
+const Separator = "."
+
+// syncTimeout bounds re-fetching an upstream's tools and prompts after its
+// server reports a change or the connection is re-established
+const syncTimeout = 30 * time.Second
+
+// Gateway exposes upstream MCP servers through one server. An upstream that
+// fails does not affect the others: calls routed to it fail until its client
+// reconnects, and it is left out of resource listings meanwhile.
+type Gateway struct {
+	server *mcp.Server
+	logger atomic.Pointer[slog.Logger]
+
+	mu        sync.Mutex
+	upstreams map[string]*upstream
+}
+
+// upstream is a server added to the gateway
+type upstream struct {
+	name   string
+	client *mcp.Client
+
+	// syncMu serializes syncs, which own the fields below
+	syncMu  sync.Mutex
+	tools   map[string]bool // namespaced names registered on the gateway
+	prompts map[string]bool
+	removed bool
+}
+
+// New creates a gateway serving upstreams through server, which can be
+// configured with authentication, policies and middleware like any other
+func New(server *mcp.Server) *Gateway {
+	g := &Gateway{
+		server:    server,
+		upstreams: make(map[string]*upstream),
+	}
+	g.logger.Store(slog.Default())
+	return g
+}
+
+// WithLogger sends the gateway's log records to logger instead of
+// slog.Default()
+func (g *Gateway) WithLogger(logger *slog.Logger) *Gateway {
+	g.logger.Store(logger)
+	return g
+}
+
+// log returns the gateway's logger
+func (g *Gateway) log() *slog.Logger {
+	return g.logger.Load()
+}
+
+// Server returns the server the gateway registers upstream tools,
+// resources and prompts on
+func (g *Gateway) Server() *mcp.Server {
+	return g.server
+}
+
+// Add exposes the tools, resources and prompts of an initialized client
+// under name. The gateway takes over the client's OnStateChange,
+// OnToolsChanged and OnListChanged callbacks to follow changes upstream; the
+// caller still owns the client and closes it after Remove.
+func (g *Gateway) Add(ctx context.Context, name string, client *mcp.Client) error {
+	if name == "" || strings.Contains(name, Separator) {
+		return fmt.Errorf("invalid upstream name %q", name)
+	}
+	result := client.InitializeResult()
+	if result == nil {
+		return fmt.Errorf("upstream %s: %w", name, mcp.ErrNotInitialized)
+	}
+
+	u := &upstream{
+		name:    name,
+		client:  client,
+		tools:   make(map[string]bool),
+		prompts: make(map[string]bool),
+	}
+
+	g.mu.Lock()
+	if _, exists := g.upstreams[name]; exists {
+		g.mu.Unlock()
+		return fmt.Errorf("upstream %s already added", name)
+	}
+	g.upstreams[name] = u
+	g.mu.Unlock()
+
+	// Follow changes before the first sync so none made during it are missed;
+	// resyncs wait for it to finish
+	client.OnToolsChanged(func([]mcp.Tool) {
+		go g.resync(u)
+	})
+	client.OnListChanged(func(kind string) {
+		switch kind {
+		case mcp.PromptsListChanged:
+			g.resync(u)
+		case mcp.ResourcesListChanged:
+			g.resourcesChanged(u)
+		}
+	})
+	client.OnStateChange(func(state mcp.ConnectionState, err error) {
+		if err != nil {
+			g.log().Warn("MCP upstream connection changed", "upstream", name, "state", state, "err", err)
+		}
+		// The new session may expose different tools and prompts
+		if state == mcp.StateConnected {
+			go g.resync(u)
+		}
+	})
+
+	if err := g.sync(ctx, u); err != nil {
+		g.Remove(name)
+		return err
+	}
+	if result.Capabilities.Resources.Supported {
+		if err := g.server.RegisterResourceProvider(name, &resourceProvider{upstream: u}); err != nil {
+			g.Remove(name)
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove stops exposing the upstream added under name
+func (g *Gateway) Remove(name string) error {
+	g.mu.Lock()
+	u, ok := g.upstreams[name]
+	delete(g.upstreams, name)
+	g.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("upstream %s not found", name)
+	}
+
+	u.client.OnToolsChanged(nil)
+	u.client.OnListChanged(nil)
+	u.client.OnStateChange(nil)
+
+	u.syncMu.Lock()
+	defer u.syncMu.Unlock()
+	u.removed = true
+	for tool := range u.tools {
+		_ = g.server.UnregisterTool(tool)
+	}
+	for prompt := range u.prompts {
+		_ = g.server.UnregisterPrompt(prompt)
+	}
+	// Only upstreams that serve resources registered a provider
+	_ = g.server.UnregisterResourceProvider(name)
+	return nil
+}
+
+// Status returns the connection state of each upstream by name
+func (g *Gateway) Status() map[string]mcp.ConnectionState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	status := make(map[string]mcp.ConnectionState, len(g.upstreams))
+	for name, u := range g.upstreams {
+		status[name] = u.client.State()
+	}
+	return status
+}
+
+// Refresh re-fetches the tools and prompts of every upstream. Upstreams that
+// cannot be reached keep what they last exposed.
+func (g *Gateway) Refresh(ctx context.Context) error {
+	g.mu.Lock()
+	upstreams := make([]*upstream, 0, len(g.upstreams))
+	for _, u := range g.upstreams {
+		upstreams = append(upstreams, u)
+	}
+	g.mu.Unlock()
+
+	var errs []error
+	for _, u := range upstreams {
+		if err := g.sync(ctx, u); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resync re-fetches an upstream's tools and prompts in the background
+func (g *Gateway) resync(u *upstream) {
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	if err := g.sync(ctx, u); err != nil {
+		g.log().Error("error syncing MCP upstream", "upstream", u.name, "err", err)
+	}
+}
+
+// resourcesChanged tells the gateway's clients that an upstream's resources
+// changed, since they are listed through its provider rather than registered
+func (g *Gateway) resourcesChanged(u *upstream) {
+	u.syncMu.Lock()
+	removed := u.removed
+	u.syncMu.Unlock()
+	if removed {
+		return
+	}
+
+	err := g.server.Broadcast(mcp.NotificationParams{
+		Type:    mcp.ResourcesListChanged,
+		Message: mcp.ResourcesListChanged,
+	})
+	if err != nil {
+		g.log().Error("error sending notification", "upstream", u.name, "type", mcp.ResourcesListChanged, "err", err)
+	}
+}
+
+// sync registers the upstream's current tools and prompts on the gateway
+// server under namespaced names and removes those it no longer has
+func (g *Gateway) sync(ctx context.Context, u *upstream) error {
+	u.syncMu.Lock()
+	defer u.syncMu.Unlock()
+	if u.removed {
+		return nil
+	}
+
+	result := u.client.InitializeResult()
+	if result == nil {
+		return fmt.Errorf("upstream %s: %w", u.name, mcp.ErrNotInitialized)
+	}
+
+	tools := make(map[string]bool)
+	if result.Capabilities.Tools.Supported {
+		listed, err := u.client.ListTools(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing tools of upstream %s: %w", u.name, err)
+		}
+		for _, tool := range listed {
+			upstreamName := tool.Name
+			tool.Name = u.name + Separator + tool.Name
+			if err := g.server.ReplaceTool(tool, g.forwardTool(u, upstreamName)); err != nil {
+				g.log().Warn("skipping MCP upstream tool", "upstream", u.name, "tool", upstreamName, "err", err)
+				continue
+			}
+			tools[tool.Name] = true
+		}
+	}
+
+	prompts := make(map[string]bool)
+	if result.Capabilities.Prompts.Supported {
+		listed, err := u.client.ListPrompts(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing prompts of upstream %s: %w", u.name, err)
+		}
+		for _, prompt := range listed {
+			upstreamName := prompt.Name
+			prompt.Name = u.name + Separator + prompt.Name
+			if err := g.server.ReplacePromptHandler(prompt, g.forwardPrompt(u, upstreamName)); err != nil {
+				g.log().Warn("skipping MCP upstream prompt", "upstream", u.name, "prompt", upstreamName, "err", err)
+				continue
+			}
+			prompts[prompt.Name] = true
+		}
+	}
+
+	for tool := range u.tools {
+		if !tools[tool] {
+			_ = g.server.UnregisterTool(tool)
+		}
+	}
+	for prompt := range u.prompts {
+		if !prompts[prompt] {
+			_ = g.server.UnregisterPrompt(prompt)
+		}
+	}
+	u.tools, u.prompts = tools, prompts
+	return nil
+}
+
+// forwardTool returns a handler that calls the named tool upstream,
+// relaying its progress
+func (g *Gateway) forwardTool(u *upstream, name string) mcp.ToolHandler {
+	return func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		progress := mcp.ProgressFromContext(ctx)
+		result, err := u.client.CallTool(ctx, name, arguments, mcp.WithProgress(func(done, total float64, message string) {
+			_ = progress.Report(done, total, message)
+		}))
+		if err != nil {
+			return nil, upstreamError(u.name, err)
+		}
+		return result, nil
+	}
+}
+
+// forwardPrompt returns a handler that renders the named prompt upstream
+func (g *Gateway) forwardPrompt(u *upstream, name string) mcp.PromptHandler {
+	return func(ctx context.Context, arguments map[string]interface{}) (*mcp.PromptRenderResult, error) {
+		result, err := u.client.RenderPrompt(ctx, name, arguments)
+		if err != nil {
+			return nil, upstreamError(u.name, err)
+		}
+		return result, nil
+	}
+}
+
+// upstreamError relays errors the upstream server returned as they are and
+// reports any other failure to reach it as a server error naming it
+func upstreamError(name string, err error) error {
+	var mcpErr *mcp.MCPError
+	if errors.As(err, &mcpErr) {
+		return mcpErr
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return mcp.NewError(mcp.CodeServerError, fmt.Sprintf("upstream %s unavailable: %v", name, err), map[string]interface{}{"upstream": name})
+}
+
+// resourceProvider serves an upstream's resources
+type resourceProvider struct {
+	upstream *upstream
+}
+
+// List implements mcp.ResourceProvider. An unreachable upstream lists no
+// resources rather than failing the whole listing.
+func (p *resourceProvider) List(ctx context.Context) ([]mcp.Resource, error) {
+	u := p.upstream
+	if u.client.State() != mcp.StateConnected {
+		return nil, nil
+	}
+
+	resources, err := u.client.ListResources(ctx)
+	if err != nil {
+		var mcpErr *mcp.MCPError
+		if errors.As(err, &mcpErr) {
+			return nil, fmt.Errorf("error listing resources of upstream %s: %w", u.name, err)
+		}
+		mcp.LoggerFromContext(ctx).Warn("MCP upstream unavailable", "upstream", u.name, "err", err)
+		return nil, nil
+	}
+
+	sort.Slice(resources, func(i, j int) bool { return resources[i].URI < resources[j].URI })
+	return resources, nil
+}
+
+// Read implements mcp.ResourceProvider. An unreachable upstream reports
+// every resource as not found, so other upstreams are still consulted.
+func (p *resourceProvider) Read(ctx context.Context, uri string) (*mcp.ResourceContents, error) {
+	contents, err := p.upstream.client.ReadResource(ctx, uri)
+	if err != nil {
+		return nil, p.resourceError(uri, err)
+	}
+	return contents, nil
+}
+
+// Write implements mcp.WritableResourceProvider
+func (p *resourceProvider) Write(ctx context.Context, contents mcp.ResourceContents) error {
+	if err := p.upstream.client.WriteResource(ctx, contents); err != nil {
+		return p.resourceError(contents.URI, err)
+	}
+	return nil
+}
+
+// resourceError relays errors the upstream returned and reports an
+// unreachable upstream as not serving uri
+func (p *resourceProvider) resourceError(uri string, err error) error {
+	var mcpErr *mcp.MCPError
+	if errors.As(err, &mcpErr) {
+		return mcpErr
+	}
+	name := p.upstream.name
+	return mcp.NewError(mcp.CodeResourceNotFound, fmt.Sprintf("upstream %s unavailable: %v", name, err),
+		map[string]interface{}{"upstream": name, "uri": uri})
+}
@@ -0,0 +1,267 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gavinvolpe/nexus/internal/mcp"
+)
+
+// connect serves s on one end of a pipe and returns an initialized client on
+// the other
+func connect(t *testing.T, s *mcp.Server) *mcp.Client {
+	t.Helper()
+
+	serverRead, clientWrite := io.Pipe()
+	clientRead, serverWrite := io.Pipe()
+	go s.ServeTransport(mcp.NewStdioTransport(serverRead, serverWrite))
+	client := mcp.NewClientWithTransport(mcp.NewStdioTransport(clientRead, clientWrite), mcp.ClientCapabilities{})
+	t.Cleanup(func() { client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Initialize(ctx, "file:///workspace"); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	return client
+}
+
+// echoTool returns a handler that responds with prefix followed by its
+// path argument
+func echoTool(prefix string) mcp.ToolHandler {
+	return func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		var args struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return nil, err
+		}
+		return prefix + args.Path, nil
+	}
+}
+
+func TestGateway(t *testing.T) {
+	git := mcp.NewServer()
+	if err := git.RegisterTool(mcp.Tool{Name: "diff"}, echoTool("diff of ")); err != nil {
+		t.Fatal(err)
+	}
+	err := git.RegisterPrompt(mcp.Prompt{
+		Name:      "commit",
+		Template:  "Describe {{.change}}",
+		Arguments: []mcp.PromptArgument{{Name: "change", Required: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := mcp.NewServer()
+	if err := fs.RegisterTool(mcp.Tool{Name: "read"}, echoTool("contents of ")); err != nil {
+		t.Fatal(err)
+	}
+	memory := mcp.NewMemoryProvider()
+	memory.Set(mcp.Resource{URI: "memory://notes"}, mcp.ResourceContents{Text: "remember"})
+	if err := fs.RegisterResourceProvider("memory", memory); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	g := New(mcp.NewServer())
+	if err := g.Add(ctx, "git", connect(t, git)); err != nil {
+		t.Fatalf("Add(git) error = %v", err)
+	}
+	fsClient := connect(t, fs)
+	if err := g.Add(ctx, "fs", fsClient); err != nil {
+		t.Fatalf("Add(fs) error = %v", err)
+	}
+	if err := g.Add(ctx, "fs.sub", fsClient); err == nil {
+		t.Error("Add() with a namespaced name succeeded, want error")
+	}
+	client := connect(t, g.Server())
+
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	slices.Sort(names)
+	if want := []string{"fs.read", "git.diff"}; !slices.Equal(names, want) {
+		t.Errorf("ListTools() = %v, want %v", names, want)
+	}
+
+	call := func(name string) (string, error) {
+		raw, err := client.CallTool(ctx, name, map[string]string{"path": "main.go"})
+		if err != nil {
+			return "", err
+		}
+		var result string
+		err = json.Unmarshal(raw, &result)
+		return result, err
+	}
+	if result, err := call("git.diff"); err != nil || result != "diff of main.go" {
+		t.Errorf("CallTool(git.diff) = %q, %v, want the upstream result", result, err)
+	}
+
+	rendered, err := client.RenderPrompt(ctx, "git.commit", map[string]interface{}{"change": "the fix"})
+	if err != nil {
+		t.Fatalf("RenderPrompt() error = %v", err)
+	}
+	want := []mcp.PromptMessage{{Role: mcp.RoleUser, Content: "Describe the fix"}}
+	if !slices.Equal(rendered.Messages, want) {
+		t.Errorf("RenderPrompt() messages = %+v, want %+v", rendered.Messages, want)
+	}
+	if _, err := client.RenderPrompt(ctx, "git.commit", nil); !errors.Is(err, mcp.ErrInvalidParams) {
+		t.Errorf("RenderPrompt() without arguments error = %v, want %v", err, mcp.ErrInvalidParams)
+	}
+
+	contents, err := client.ReadResource(ctx, "memory://notes")
+	if err != nil || contents.Text != "remember" {
+		t.Fatalf("ReadResource() = %+v, %v, want the upstream contents", contents, err)
+	}
+
+	// A failed upstream fails only the calls routed to it
+	fsClient.Close()
+	if _, err := call("fs.read"); !errors.Is(err, mcp.ErrServer) {
+		t.Errorf("CallTool(fs.read) after upstream closed error = %v, want %v", err, mcp.ErrServer)
+	}
+	if result, err := call("git.diff"); err != nil || result != "diff of main.go" {
+		t.Errorf("CallTool(git.diff) after fs closed = %q, %v, want the upstream result", result, err)
+	}
+	if resources, err := client.ListResources(ctx); err != nil || len(resources) != 0 {
+		t.Errorf("ListResources() after upstream closed = %v, %v, want none", resources, err)
+	}
+	if status := g.Status(); status["fs"] != mcp.StateClosed || status["git"] != mcp.StateConnected {
+		t.Errorf("Status() = %v, want fs closed and git connected", status)
+	}
+
+	if err := g.Remove("fs"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := call("fs.read"); !errors.Is(err, mcp.ErrToolNotFound) {
+		t.Errorf("CallTool(fs.read) after Remove error = %v, want %v", err, mcp.ErrToolNotFound)
+	}
+}
+
+func TestGatewayAddFollowsChanges(t *testing.T) {
+	upstreamServer := mcp.NewServer()
+	if err := upstreamServer.RegisterTool(mcp.Tool{Name: "first"}, echoTool("")); err != nil {
+		t.Fatal(err)
+	}
+	client := connect(t, upstreamServer)
+
+	// The upstream gains a tool while the gateway's first sync is listing
+	// them, and the sync does not complete until the client has re-fetched
+	// the list in response
+	var lists atomic.Int32
+	refreshed := make(chan struct{})
+	client.Use(func(next mcp.HandlerFunc) mcp.HandlerFunc {
+		return func(ctx context.Context, msg *mcp.MCPMessage) (*mcp.MCPMessage, error) {
+			if msg.Method != mcp.ToolsList {
+				return next(ctx, msg)
+			}
+			response, err := next(ctx, msg)
+			switch lists.Add(1) {
+			case 1:
+				if err := upstreamServer.RegisterTool(mcp.Tool{Name: "second"}, echoTool("")); err != nil {
+					t.Error(err)
+				}
+				<-refreshed
+			case 2:
+				close(refreshed)
+			}
+			return response, err
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	g := New(mcp.NewServer())
+	if err := g.Add(ctx, "up", client); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	gatewayClient := connect(t, g.Server())
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := gatewayClient.CallTool(ctx, "up.second", map[string]string{})
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, mcp.ErrToolNotFound) || time.Now().After(deadline) {
+			t.Fatalf("CallTool(up.second) error = %v, want the tool added during Add", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGatewayFollowsListChanges(t *testing.T) {
+	upstreamServer := mcp.NewServer()
+	if err := upstreamServer.RegisterResource(mcp.Resource{URI: "memory://first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := upstreamServer.RegisterPrompt(mcp.Prompt{Name: "first", Template: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	g := New(mcp.NewServer())
+	if err := g.Add(ctx, "up", connect(t, upstreamServer)); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	gatewayClient := connect(t, g.Server())
+	changed := make(chan string, 10)
+	gatewayClient.OnListChanged(func(kind string) {
+		changed <- kind
+	})
+
+	// A prompt added upstream after Add is picked up by a resync
+	if err := upstreamServer.RegisterPrompt(mcp.Prompt{Name: "second", Template: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := gatewayClient.RenderPrompt(ctx, "up.second", nil)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("RenderPrompt(up.second) error = %v, want the prompt added upstream", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Resources added upstream are announced to the gateway's clients
+	if err := upstreamServer.RegisterResource(mcp.Resource{URI: "memory://second"}); err != nil {
+		t.Fatal(err)
+	}
+	for kind := ""; kind != mcp.ResourcesListChanged; {
+		select {
+		case kind = <-changed:
+		case <-ctx.Done():
+			t.Fatal("no resources/list_changed notification from the gateway")
+		}
+	}
+	resources, err := gatewayClient.ListResources(ctx)
+	if err != nil {
+		t.Fatalf("ListResources() error = %v", err)
+	}
+	var uris []string
+	for _, resource := range resources {
+		uris = append(uris, resource.URI)
+	}
+	slices.Sort(uris)
+	if want := []string{"memory://first", "memory://second"}; !slices.Equal(uris, want) {
+		t.Errorf("ListResources() = %v, want %v", uris, want)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// ErrUnauthenticated is returned by authenticators for missing or invalid
+// credentials
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Principal identifies an authenticated client
+type Principal struct {
+	ID    string
+	Roles []string
+}
+
+// Credentials are what a client presents to authenticate. Token comes from
+// the Authorization header of the HTTP request that opened the connection or
+// from InitializeParams.AuthToken; TLS is set for connections over TLS.
+type Credentials struct {
+	Token string
+	TLS   *tls.ConnectionState
+}
+
+// empty reports whether the credentials carry nothing to authenticate
+func (c Credentials) empty() bool {
+	return c.Token == "" && (c.TLS == nil || len(c.TLS.PeerCertificates) == 0)
+}
+
+// Authenticator verifies credentials and returns the principal they belong to
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds Credentials) (*Principal, error)
+}
+
+// AuthenticatorFunc adapts a function into an Authenticator
+type AuthenticatorFunc func(ctx context.Context, creds Credentials) (*Principal, error)
+
+// Authenticate implements Authenticator
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, creds Credentials) (*Principal, error) {
+	return f(ctx, creds)
+}
+
+// FirstOf returns an Authenticator that tries each authenticator in order
+// and accepts the first principal returned
+func FirstOf(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, creds Credentials) (*Principal, error) {
+		for _, a := range authenticators {
+			if principal, err := a.Authenticate(ctx, creds); err == nil {
+				return principal, nil
+			}
+		}
+		return nil, ErrUnauthenticated
+	})
+}
+
+// TokenAuthenticator accepts a fixed set of bearer tokens
+type TokenAuthenticator struct {
+	tokens map[string]*Principal
+}
+
+// NewTokenAuthenticator creates an authenticator that maps each token to
+// its principal
+func NewTokenAuthenticator(tokens map[string]*Principal) *TokenAuthenticator {
+	a := &TokenAuthenticator{tokens: make(map[string]*Principal, len(tokens))}
+	for token, principal := range tokens {
+		a.tokens[token] = principal
+	}
+	return a
+}
+
+// Authenticate implements Authenticator. Every token is compared in
+// constant time so the response time does not reveal near matches.
+func (a *TokenAuthenticator) Authenticate(ctx context.Context, creds Credentials) (*Principal, error) {
+	var match *Principal
+	for token, principal := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(creds.Token)) == 1 {
+			match = principal
+		}
+	}
+	if creds.Token == "" || match == nil {
+		return nil, ErrUnauthenticated
+	}
+	return match, nil
+}
+
+// HMACClaims are the claims carried by an HMAC-signed token
+type HMACClaims struct {
+	Subject   string   `json:"sub"`
+	Roles     []string `json:"roles,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"` // Unix seconds; 0 never expires
+}
+
+// SignHMACToken creates a token for claims signed with secret using
+// HMAC-SHA256. The token is the base64url-encoded claims and signature
+// joined by a dot.
+func SignHMACToken(secret []byte, claims HMACClaims) (string, error) {
+	payload, err := sonic.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling claims: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signHMAC(secret, encoded)), nil
+}
+
+func signHMAC(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// HMACAuthenticator accepts tokens created by SignHMACToken with its secret
+type HMACAuthenticator struct {
+	secret []byte
+}
+
+// NewHMACAuthenticator creates an authenticator for tokens signed with secret
+func NewHMACAuthenticator(secret []byte) *HMACAuthenticator {
+	return &HMACAuthenticator{secret: secret}
+}
+
+// Authenticate implements Authenticator
+func (a *HMACAuthenticator) Authenticate(ctx context.Context, creds Credentials) (*Principal, error) {
+	payload, signature, ok := strings.Cut(creds.Token, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed token", ErrUnauthenticated)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, signHMAC(a.secret, payload)) {
+		return nil, fmt.Errorf("%w: invalid token signature", ErrUnauthenticated)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token", ErrUnauthenticated)
+	}
+	var claims HMACClaims
+	if err := sonic.Unmarshal(data, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed token claims", ErrUnauthenticated)
+	}
+	if claims.ExpiresAt != 0 && time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: token expired", ErrUnauthenticated)
+	}
+
+	return &Principal{ID: claims.Subject, Roles: claims.Roles}, nil
+}
+
+// TLSAuthenticator accepts clients that presented a certificate verified
+// against the server's client CAs. The principal ID is the certificate's
+// common name and its roles are the certificate's organizational units.
+type TLSAuthenticator struct{}
+
+// Authenticate implements Authenticator
+func (TLSAuthenticator) Authenticate(ctx context.Context, creds Credentials) (*Principal, error) {
+	if creds.TLS == nil || len(creds.TLS.VerifiedChains) == 0 {
+		return nil, fmt.Errorf("%w: no verified client certificate", ErrUnauthenticated)
+	}
+
+	cert := creds.TLS.VerifiedChains[0][0]
+	return &Principal{
+		ID:    cert.Subject.CommonName,
+		Roles: cert.Subject.OrganizationalUnit,
+	}, nil
+}
+
+// credentialsFromRequest extracts the credentials an HTTP request carries
+func credentialsFromRequest(r *http.Request) Credentials {
+	creds := Credentials{TLS: r.TLS}
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		creds.Token = strings.TrimSpace(token)
+	}
+	return creds
+}
+
+// authenticateRequest authenticates the credentials on an HTTP request. A
+// request without credentials is let through unauthenticated so the client
+// can present a token during initialize instead.
+func (s *Server) authenticateRequest(r *http.Request) (*Principal, error) {
+	s.mu.RLock()
+	authenticator := s.authenticator
+	s.mu.RUnlock()
+
+	creds := credentialsFromRequest(r)
+	if authenticator == nil || creds.empty() {
+		return nil, nil
+	}
+	return authenticator.Authenticate(r.Context(), creds)
+}
+
+// Access is the kind of access requested to a resource
+type Access int
+
+const (
+	// ReadAccess covers listing and reading a resource
+	ReadAccess Access = iota
+	// WriteAccess covers writing a resource
+	WriteAccess
+)
+
+// Policy decides what a principal may list and invoke. The principal is nil
+// for clients of a server without an authenticator.
+type Policy interface {
+	AllowTool(principal *Principal, name string) bool
+	AllowResource(principal *Principal, uri string, access Access) bool
+	AllowPrompt(principal *Principal, name string) bool
+}
+
+// allowAll is the policy of servers that have not been given one
+type allowAll struct{}
+
+func (allowAll) AllowTool(*Principal, string) bool             { return true }
+func (allowAll) AllowResource(*Principal, string, Access) bool { return true }
+func (allowAll) AllowPrompt(*Principal, string) bool           { return true }
+
+// AccessRule lists what a role may access. Entries are exact tool names,
+// prompt names or resource URIs, or prefixes ending in "*"; a lone "*"
+// matches everything.
+type AccessRule struct {
+	Tools          []string `json:"tools,omitempty"`
+	Resources      []string `json:"resources,omitempty"`       // readable resource URIs
+	WriteResources []string `json:"write_resources,omitempty"` // writable resource URIs
+	Prompts        []string `json:"prompts,omitempty"`
+}
+
+// RolePolicy grants each role the access in its rule. A principal may access
+// anything granted to any of its roles; unauthenticated clients have no roles.
+type RolePolicy map[string]AccessRule
+
+// AllowTool implements Policy
+func (p RolePolicy) AllowTool(principal *Principal, name string) bool {
+	return p.allow(principal, func(rule AccessRule) []string { return rule.Tools }, name)
+}
+
+// AllowResource implements Policy
+func (p RolePolicy) AllowResource(principal *Principal, uri string, access Access) bool {
+	if access == WriteAccess {
+		return p.allow(principal, func(rule AccessRule) []string { return rule.WriteResources }, uri)
+	}
+	return p.allow(principal, func(rule AccessRule) []string { return rule.Resources }, uri)
+}
+
+// AllowPrompt implements Policy
+func (p RolePolicy) AllowPrompt(principal *Principal, name string) bool {
+	return p.allow(principal, func(rule AccessRule) []string { return rule.Prompts }, name)
+}
+
+func (p RolePolicy) allow(principal *Principal, patterns func(AccessRule) []string, name string) bool {
+	if principal == nil {
+		return false
+	}
+	for _, role := range principal.Roles {
+		rule, ok := p[role]
+		if !ok {
+			continue
+		}
+		for _, pattern := range patterns(rule) {
+			if matchPattern(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchPattern matches name against an exact value or a prefix ending in "*"
+func matchPattern(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return pattern == name
+}
+
+type principalKey struct{}
+
+// withPrincipal returns a context carrying the caller's principal
+func withPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of the client whose call is
+// being handled, or nil if the client is unauthenticated
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// access returns the server's policy and the principal authenticated on
+// msg's connection
+func (s *Server) access(msg *MCPMessage) (Policy, *Principal) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var principal *Principal
+	if client, ok := s.clients[msg.Conn]; ok {
+		principal = client.Principal
+	}
+	return s.policy, principal
+}
+
+// forbidden returns the error for a call the policy does not allow
+func forbidden(kind, name string) *MCPError {
+	return errorf(CodeForbidden, map[string]interface{}{kind: name}, "access to %s %s denied", kind, name)
+}
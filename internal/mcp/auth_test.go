@@ -0,0 +1,191 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticators(t *testing.T) {
+	secret := []byte("secret")
+	sign := func(claims HMACClaims) string {
+		token, err := SignHMACToken(secret, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tokens := NewTokenAuthenticator(map[string]*Principal{
+		"alice-token": {ID: "alice"},
+	})
+	hmacAuth := NewHMACAuthenticator(secret)
+
+	tests := []struct {
+		name   string
+		auth   Authenticator
+		token  string
+		wantID string
+	}{
+		{name: "valid bearer token", auth: tokens, token: "alice-token", wantID: "alice"},
+		{name: "unknown bearer token", auth: tokens, token: "mallory-token"},
+		{name: "empty bearer token", auth: tokens, token: ""},
+		{name: "valid hmac token", auth: hmacAuth, token: sign(HMACClaims{Subject: "bob"}), wantID: "bob"},
+		{name: "expired hmac token", auth: hmacAuth, token: sign(HMACClaims{Subject: "bob", ExpiresAt: time.Now().Add(-time.Minute).Unix()})},
+		{name: "hmac token signed with another secret", auth: NewHMACAuthenticator([]byte("other")), token: sign(HMACClaims{Subject: "bob"})},
+		{name: "malformed hmac token", auth: hmacAuth, token: "not-a-token"},
+		{name: "first of", auth: FirstOf(TLSAuthenticator{}, tokens), token: "alice-token", wantID: "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := tt.auth.Authenticate(context.Background(), Credentials{Token: tt.token})
+			if tt.wantID == "" {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, ErrUnauthenticated)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if principal.ID != tt.wantID {
+				t.Errorf("Authenticate() principal = %q, want %q", principal.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	noop := func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		return PrincipalFromContext(ctx).ID, nil
+	}
+
+	s := NewServer().
+		WithAuthenticator(NewTokenAuthenticator(map[string]*Principal{
+			"reader-token": {ID: "reader", Roles: []string{"reader"}},
+		})).
+		WithPolicy(RolePolicy{
+			"reader": {Tools: []string{"search*"}},
+		})
+	for _, name := range []string{"search", "search_docs", "delete"} {
+		if err := s.RegisterTool(Tool{Name: name}, noop); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Clients without a valid token cannot initialize
+	serverSide, clientSide := pipeTransports()
+	go s.ServeTransport(serverSide)
+	anonymous := NewClientWithTransport(clientSide, ClientCapabilities{}).WithAuthToken("wrong")
+	defer anonymous.Close()
+	if _, err := anonymous.Initialize(ctx, ""); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Initialize() with an invalid token error = %v, want %v", err, ErrUnauthorized)
+	}
+
+	serverSide, clientSide = pipeTransports()
+	go s.ServeTransport(serverSide)
+	client := NewClientWithTransport(clientSide, ClientCapabilities{}).WithAuthToken("reader-token")
+	defer client.Close()
+	if _, err := client.Initialize(ctx, ""); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+	if len(tools) != 2 {
+		t.Errorf("ListTools() = %v, want only the search tools", tools)
+	}
+
+	result, err := client.CallTool(ctx, "search", nil)
+	if err != nil {
+		t.Fatalf("CallTool(search) error = %v", err)
+	}
+	if string(result) != `"reader"` {
+		t.Errorf("CallTool(search) = %s, want the caller's principal", result)
+	}
+
+	_, err = client.CallTool(ctx, "delete", nil)
+	var mcpErr *MCPError
+	if !errors.As(err, &mcpErr) || !errors.Is(err, ErrForbidden) {
+		t.Fatalf("CallTool(delete) error = %v, want %v", err, ErrForbidden)
+	}
+	if data, _ := mcpErr.Data.(map[string]interface{}); data["tool"] != "delete" {
+		t.Errorf("CallTool(delete) error data = %v, want the denied tool", mcpErr.Data)
+	}
+}
+
+func TestSSESessionPrincipal(t *testing.T) {
+	s := NewServer().
+		WithAuthenticator(NewTokenAuthenticator(map[string]*Principal{
+			"reader-token": {ID: "reader", Roles: []string{"reader"}},
+			"writer-token": {ID: "writer", Roles: []string{"writer"}},
+		})).
+		WithPolicy(RolePolicy{
+			"reader": {Tools: []string{"search"}},
+		})
+	err := s.RegisterTool(Tool{Name: "search"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		return PrincipalFromContext(ctx).ID, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newHTTPServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The session is opened without credentials and authenticated by the
+	// token sent with initialize
+	transport, err := DialSSE(ts.URL+DefaultPath, nil)
+	if err != nil {
+		t.Fatalf("DialSSE() error = %v", err)
+	}
+	client := NewClientWithTransport(transport, ClientCapabilities{}).WithAuthToken("reader-token")
+	defer client.Close()
+	if _, err := client.Initialize(ctx, ""); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	result, err := client.CallTool(ctx, "search", nil)
+	if err != nil || string(result) != `"reader"` {
+		t.Fatalf("CallTool(search) = %s, %v, want the reader's access", result, err)
+	}
+
+	id := transport.(*sseClientTransport).sessionID
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "same principal", token: "reader-token", want: http.StatusAccepted},
+		{name: "other principal", token: "writer-token", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, ts.URL+DefaultPath, strings.NewReader(`{"jsonrpc":"2.0","method":"ping"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(SessionIDHeader, id)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("POST status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
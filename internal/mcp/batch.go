@@ -0,0 +1,280 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/bytedance/sonic"
+)
+
+// isBatch reports whether a frame holds a JSON-RPC batch, an array of
+// messages, rather than a single message
+func isBatch(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '['
+}
+
+// batchReply collects the responses to the requests in a batch so they can
+// be written as a single frame. Handlers write their responses to it as they
+// would to the connection, while the notifications they send, such as
+// progress, still go to the connection directly.
+type batchReply struct {
+	mu     sync.Mutex
+	frames [][]byte
+}
+
+// ReadMessage implements Transport. Nothing is ever read from a batchReply.
+func (r *batchReply) ReadMessage() ([]byte, error) {
+	return nil, io.EOF
+}
+
+// WriteMessage implements Transport
+func (r *batchReply) WriteMessage(data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frames = append(r.frames, append([]byte(nil), data...))
+	return nil
+}
+
+// Close implements Transport
+func (r *batchReply) Close() error {
+	return nil
+}
+
+// flush writes the collected responses to t as one array. Nothing is written
+// if the batch held only notifications.
+func (r *batchReply) flush(t Transport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.frames) == 0 {
+		return nil
+	}
+
+	frame := append([]byte{'['}, bytes.Join(r.frames, []byte{','})...)
+	return t.WriteMessage(append(frame, ']'))
+}
+
+// serveBatch dispatches each message in a batch received on state's
+// connection and writes their responses together once all have been handled.
+// It returns false once the server has begun shutting down.
+func (s *Server) serveBatch(ctx context.Context, state *ClientState, data []byte, handlers *sync.WaitGroup) bool {
+	var frames []json.RawMessage
+	if err := sonic.Unmarshal(data, &frames); err != nil {
+		s.sendError(state.conn, nil, NewError(CodeParseError, "parse error", err.Error()))
+		return true
+	}
+	if len(frames) == 0 {
+		s.sendError(state.conn, nil, NewError(CodeInvalidRequest, "empty batch", nil))
+		return true
+	}
+
+	reply := &batchReply{}
+	var members sync.WaitGroup
+	serving := true
+	for _, frame := range frames {
+		var msg MCPMessage
+		if err := sonic.Unmarshal(frame, &msg); err != nil {
+			s.sendError(reply, nil, NewError(CodeInvalidRequest, "invalid request", err.Error()))
+			continue
+		}
+		if serving = s.dispatch(ctx, state, reply, &msg, &members); !serving {
+			break
+		}
+	}
+
+	handlers.Add(1)
+	go func() {
+		defer handlers.Done()
+		members.Wait()
+		if err := reply.flush(state.conn); err != nil {
+			s.log().Error("error writing batch response", "err", err)
+			state.conn.Close()
+		}
+	}()
+	return serving
+}
+
+// BatchRequest is a request sent with others by Client.Batch
+type BatchRequest struct {
+	Method MCPMethod
+	Params interface{}
+}
+
+// ToolCallRequest returns a batch request calling the named tool
+func ToolCallRequest(name string, arguments interface{}) BatchRequest {
+	return BatchRequest{
+		Method: ToolsCall,
+		Params: map[string]interface{}{"name": name, "arguments": arguments},
+	}
+}
+
+// ReadResourceRequest returns a batch request reading the resource at uri
+func ReadResourceRequest(uri string) BatchRequest {
+	return BatchRequest{Method: ResourcesRead, Params: resourceParams{URI: uri}}
+}
+
+// BatchResult is the outcome of one request in a batch
+type BatchResult struct {
+	Result json.RawMessage
+	Err    error
+}
+
+// batch gathers the requests of a Client.Batch call into one frame
+type batch struct {
+	mu       sync.Mutex
+	messages []*MCPMessage
+	flushed  bool
+
+	// ready receives once for each request, when it has been queued or
+	// has completed without being queued
+	ready chan struct{}
+	// sent is closed once the frame has been written, or failed to be
+	// with err
+	sent chan struct{}
+	err  error
+}
+
+// Batch sends requests to the server together in one frame and waits for
+// them all, returning their results in the order of requests. Each request
+// passes through the client's middleware and succeeds or fails on its own,
+// as it would if sent with Call; the error returned is for the batch as a
+// whole, such as when the client is not connected.
+func (c *Client) Batch(ctx context.Context, requests ...BatchRequest) ([]BatchResult, error) {
+	if err := c.connectionError(); err != nil {
+		return nil, err
+	}
+	conn := c.current()
+
+	b := &batch{
+		ready: make(chan struct{}, len(requests)),
+		sent:  make(chan struct{}),
+	}
+	results := make([]BatchResult, len(requests))
+	var wg sync.WaitGroup
+	pending := 0
+	for i, request := range requests {
+		msg, err := c.batchMessage(request)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		pending++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var once sync.Once
+			ready := func() {
+				once.Do(func() { b.ready <- struct{}{} })
+			}
+			// Middleware may answer without sending the request
+			defer ready()
+
+			response, err := c.wrap(c.batchRoundTrip(b, conn, ready))(ctx, msg)
+			if err != nil {
+				results[i].Err = fmt.Errorf("%s request failed: %w", request.Method, err)
+				return
+			}
+			results[i].Result = response.Result
+		}()
+	}
+
+	b.send(ctx, conn, pending)
+	wg.Wait()
+	return results, nil
+}
+
+// batchMessage checks that the server supports a batched request and
+// builds the message for it
+func (c *Client) batchMessage(request BatchRequest) (*MCPMessage, error) {
+	if err := c.requireCapability(request.Method); err != nil {
+		return nil, err
+	}
+
+	msg := &MCPMessage{JSONRPC: "2.0", Method: request.Method}
+	if request.Params != nil {
+		params, err := sonic.Marshal(request.Params)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling params: %w", err)
+		}
+		msg.Params = params
+	}
+	return msg, nil
+}
+
+// batchRoundTrip returns the innermost handler for a request in b, which
+// queues it to be sent with the others and waits for its response. A request
+// that middleware sends again after the batch went out is sent on its own.
+func (c *Client) batchRoundTrip(b *batch, conn *connection, ready func()) HandlerFunc {
+	return func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+		b.mu.Lock()
+		if b.flushed {
+			b.mu.Unlock()
+			return c.roundTrip(ctx, msg)
+		}
+		ch, done := c.expect(msg)
+		defer done()
+		b.messages = append(b.messages, msg)
+		b.mu.Unlock()
+		ready()
+
+		<-b.sent
+		if b.err != nil {
+			return nil, b.err
+		}
+		return c.await(ctx, conn, msg.ID, ch)
+	}
+}
+
+// send waits until each of the pending requests in the batch is queued or
+// has completed, then writes the queued requests to conn as one array
+func (b *batch) send(ctx context.Context, conn *connection, pending int) {
+	defer close(b.sent)
+
+wait:
+	for ; pending > 0; pending-- {
+		select {
+		case <-b.ready:
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	b.mu.Lock()
+	b.flushed = true
+	messages := b.messages
+	b.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		b.err = err
+		return
+	}
+	if len(messages) > 0 {
+		if err := writeJSON(conn, messages); err != nil {
+			b.err = fmt.Errorf("error sending batch: %w", err)
+		}
+	}
+}
@@ -21,10 +21,18 @@ package mcp
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/gorilla/websocket"
@@ -32,39 +40,235 @@ import (
 
 // Client represents an MCP client
 type Client struct {
-	conn         *websocket.Conn
-	nextID       atomic.Int64
-	capabilities ClientCapabilities
-	handlers     map[MCPMethod]HandlerFunc
-	responses    map[interface{}]chan *MCPMessage
-	mu           sync.RWMutex
+	conn          *connection
+	nextID        atomic.Int64
+	capabilities  ClientCapabilities
+	handlers      map[MCPMethod]HandlerFunc
+	middleware    []Middleware
+	responses     map[string]chan *MCPMessage
+	progress      map[string]ProgressFunc
+	subscriptions map[string]ResourceUpdatedFunc
+	incoming      map[string]context.CancelFunc
+	rootURI       string
+	info          Implementation
+	authToken     string
+	server        *InitializeResult
+	mu            sync.RWMutex
+
+	// Connection lifecycle. Dialer is nil for clients created on an existing
+	// transport, which cannot reconnect.
+	dialer        func() (Transport, error)
+	reconnect     *ReconnectConfig
+	state         ConnectionState
+	lastErr       error
+	onStateChange StateFunc
+	closed        chan struct{}
+
+	// Cached tools/list result, invalidated by tools/list_changed
+	tools          []Tool
+	toolsValid     bool
+	toolsGen       uint64
+	onToolsChanged func([]Tool)
+
+	// Called for prompts/list_changed and resources/list_changed
+	onListChanged func(kind string)
+
+	// Log records from the server and the level requested for them, which
+	// is requested again after a reconnect
+	onLog    LogFunc
+	logLevel *slog.Level
+
+	// logger receives the client's own log records
+	logger atomic.Pointer[slog.Logger]
 }
 
-// NewClient creates a new MCP client
-func NewClient(url string, capabilities ClientCapabilities) (*Client, error) {
-	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+// ErrNotInitialized is returned for calls made before Initialize completes
+var ErrNotInitialized = errors.New("client not initialized")
+
+// ErrCapabilityNotSupported is returned for calls the server did not
+// advertise support for during initialization
+var ErrCapabilityNotSupported = errors.New("capability not supported by server")
+
+// ErrUnsupportedProtocolVersion is returned by Initialize when the server
+// answers with a protocol version the client cannot speak
+var ErrUnsupportedProtocolVersion = errors.New("unsupported protocol version")
+
+// toolsRefreshTimeout bounds the background re-fetch of the tools list
+const toolsRefreshTimeout = 30 * time.Second
+
+// ProgressFunc receives progress notifications for a request. Total is zero
+// when the amount of work is unknown. It is called from the client's read
+// loop, so it must return quickly and must not call back into the client.
+type ProgressFunc func(progress, total float64, message string)
+
+// CallOption configures a single tool call
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	onProgress ProgressFunc
+}
+
+// WithProgress asks the server to report progress for the call and delivers
+// each report to fn
+func WithProgress(fn ProgressFunc) CallOption {
+	return func(o *callOptions) {
+		o.onProgress = fn
+	}
+}
+
+// ClientConfig configures how a client connects to its server
+type ClientConfig struct {
+	Capabilities ClientCapabilities
+	Reconnect    *ReconnectConfig // nil disables reconnection
+	Header       http.Header      // sent with the HTTP requests that open the connection
+	TLSConfig    *tls.Config      // for wss and https, including client certificates
+	KeepAlive    time.Duration    // ping interval; 0 disables keepalive
+}
+
+// NewClient creates a new MCP client connected to the server at rawURL. The
+// transport is selected from the URL scheme: ws and wss use WebSockets, http
+// and https use HTTP with server-sent events. The client reconnects with
+// DefaultReconnectConfig if the connection drops.
+func NewClient(rawURL string, capabilities ClientCapabilities) (*Client, error) {
+	return NewClientWithConfig(rawURL, ClientConfig{
+		Capabilities: capabilities,
+		Reconnect:    DefaultReconnectConfig(),
+	})
+}
+
+// NewClientWithConfig creates a new MCP client connected to the server at
+// rawURL using the given configuration
+func NewClientWithConfig(rawURL string, config ClientConfig) (*Client, error) {
+	return NewClientWithDialer(func() (Transport, error) {
+		return dial(rawURL, config)
+	}, config)
+}
+
+// NewClientWithDialer creates a new MCP client on a transport opened by
+// dial. Dial is called again to reconnect if the transport fails.
+func NewClientWithDialer(dial func() (Transport, error), config ClientConfig) (*Client, error) {
+	transport, err := dial()
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to server: %w", err)
 	}
 
-	client := &Client{
-		conn:         conn,
-		capabilities: capabilities,
-		handlers:     make(map[MCPMethod]HandlerFunc),
-		responses:    make(map[interface{}]chan *MCPMessage),
+	client := newClient(transport, config.Capabilities)
+	client.dialer = dial
+	client.reconnect = config.Reconnect
+	go client.handleMessages(client.conn)
+	if config.KeepAlive > 0 {
+		go client.keepAlive(config.KeepAlive)
+	}
+
+	return client, nil
+}
+
+// dial opens a transport to rawURL based on its scheme
+func dial(rawURL string, config ClientConfig) (Transport, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server url: %w", err)
 	}
 
-	// Start message handler
-	go client.handleMessages()
+	switch u.Scheme {
+	case "ws", "wss":
+		dialer := *websocket.DefaultDialer
+		dialer.TLSClientConfig = config.TLSConfig
+		conn, _, err := dialer.Dial(rawURL, config.Header)
+		if err != nil {
+			return nil, err
+		}
+		return NewWebSocketTransport(conn), nil
+	case "http", "https":
+		client := &http.Client{}
+		if config.TLSConfig != nil {
+			client.Transport = &http.Transport{TLSClientConfig: config.TLSConfig}
+		}
+		return dialSSE(rawURL, config.Header, client)
+	default:
+		return nil, fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+}
+
+// NewStdioClient launches an MCP server binary and creates a client that
+// talks to it over the process's stdin and stdout. The server is relaunched
+// if it exits.
+func NewStdioClient(command string, args []string, capabilities ClientCapabilities) (*Client, error) {
+	client, err := NewClientWithDialer(func() (Transport, error) {
+		return NewCommandTransport(exec.Command(command, args...))
+	}, ClientConfig{
+		Capabilities: capabilities,
+		Reconnect:    DefaultReconnectConfig(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error launching server: %w", err)
+	}
 
 	return client, nil
 }
 
-// Initialize initializes the connection with the server
+// NewClientWithTransport creates a new MCP client on an established
+// transport. The client cannot reconnect once the transport fails.
+func NewClientWithTransport(transport Transport, capabilities ClientCapabilities) *Client {
+	client := newClient(transport, capabilities)
+	go client.handleMessages(client.conn)
+	return client
+}
+
+func newClient(transport Transport, capabilities ClientCapabilities) *Client {
+	client := &Client{
+		conn:          newConnection(transport),
+		capabilities:  capabilities,
+		handlers:      make(map[MCPMethod]HandlerFunc),
+		responses:     make(map[string]chan *MCPMessage),
+		progress:      make(map[string]ProgressFunc),
+		subscriptions: make(map[string]ResourceUpdatedFunc),
+		incoming:      make(map[string]context.CancelFunc),
+		info:          Implementation{Name: "nexus"},
+		state:         StateConnected,
+		closed:        make(chan struct{}),
+	}
+	client.handlers[RootsList] = client.handleRootsList
+	client.handlers[Ping] = handlePing
+	client.logger.Store(slog.Default())
+
+	return client
+}
+
+// WithInfo sets the name and version the client reports to servers
+func (c *Client) WithInfo(name, version string) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.info = Implementation{Name: name, Version: version}
+	return c
+}
+
+// WithAuthToken sets the token the client presents to servers that require
+// authentication. It is sent during Initialize, so it also works for
+// transports that cannot carry HTTP headers.
+func (c *Client) WithAuthToken(token string) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.authToken = token
+	return c
+}
+
+// Initialize initializes the connection with the server, negotiating the
+// protocol version and exchanging capabilities
 func (c *Client) Initialize(ctx context.Context, rootURI string) (*ServerCapabilities, error) {
+	c.mu.Lock()
+	c.rootURI = rootURI
+	info := c.info
+	authToken := c.authToken
+	capabilities := c.capabilities
+	c.mu.Unlock()
+
 	params := InitializeParams{
-		RootURI:      rootURI,
-		Capabilities: c.capabilities,
+		ProtocolVersion: ProtocolVersion,
+		RootURI:         rootURI,
+		Capabilities:    capabilities,
+		ClientInfo:      info,
+		AuthToken:       authToken,
 	}
 
 	paramsBytes, err := sonic.Marshal(params)
@@ -77,13 +281,19 @@ func (c *Client) Initialize(ctx context.Context, rootURI string) (*ServerCapabil
 		return nil, fmt.Errorf("initialize request failed: %w", err)
 	}
 
-	var result struct {
-		Capabilities ServerCapabilities `json:"capabilities"`
-	}
+	var result InitializeResult
 	if err := sonic.Unmarshal(response.Result, &result); err != nil {
-		return nil, fmt.Errorf("error unmarshaling server capabilities: %w", err)
+		return nil, fmt.Errorf("error unmarshaling initialize result: %w", err)
+	}
+
+	if !slices.Contains(supportedProtocolVersions, result.ProtocolVersion) {
+		return nil, fmt.Errorf("%w: server speaks %q", ErrUnsupportedProtocolVersion, result.ProtocolVersion)
 	}
 
+	c.mu.Lock()
+	c.server = &result
+	c.mu.Unlock()
+
 	// Send initialized notification
 	if err := c.sendNotification(Initialized, nil); err != nil {
 		return nil, fmt.Errorf("error sending initialized notification: %w", err)
@@ -92,25 +302,139 @@ func (c *Client) Initialize(ctx context.Context, rootURI string) (*ServerCapabil
 	return &result.Capabilities, nil
 }
 
-// ListTools retrieves the list of available tools from the server
-func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
-	response, err := c.sendRequest(ctx, ToolsList, nil)
+// InitializeResult returns what the server reported during initialization,
+// or nil if Initialize has not completed
+func (c *Client) InitializeResult() *InitializeResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.server
+}
+
+// requireCapability returns an error unless the client is connected and the
+// server advertised support for method during initialization
+func (c *Client) requireCapability(method MCPMethod) error {
+	if err := c.connectionError(); err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	server := c.server
+	c.mu.RUnlock()
+
+	if server == nil {
+		return ErrNotInitialized
+	}
+
+	var supported bool
+	switch method {
+	case ToolsList, ToolsCall:
+		supported = server.Capabilities.Tools.Supported
+	case ResourcesList, ResourcesRead, ResourcesWrite, ResourcesTemplatesList:
+		supported = server.Capabilities.Resources.Supported
+	case ResourcesSubscribe, ResourcesUnsubscribe:
+		supported = server.Capabilities.Resources.Supported && server.Capabilities.Resources.Subscribe
+	case PromptsList, PromptsRender:
+		supported = server.Capabilities.Prompts.Supported
+	case LoggingSetLevel:
+		supported = server.Capabilities.Logging.Supported
+	default:
+		supported = true
+	}
+
+	if !supported {
+		return fmt.Errorf("%w: %s", ErrCapabilityNotSupported, method)
+	}
+	return nil
+}
+
+// ListTools retrieves the list of available tools from the server, following
+// every page. The unfiltered result is cached until the server reports that
+// the list has changed.
+func (c *Client) ListTools(ctx context.Context, opts ...ListOption) ([]Tool, error) {
+	if err := c.requireCapability(ToolsList); err != nil {
+		return nil, err
+	}
+	if len(opts) > 0 {
+		return listAll[Tool](ctx, c, ToolsList, "tools", opts)
+	}
+
+	c.mu.RLock()
+	if c.toolsValid {
+		tools := slices.Clone(c.tools)
+		c.mu.RUnlock()
+		return tools, nil
+	}
+	gen := c.toolsGen
+	c.mu.RUnlock()
+
+	tools, err := listAll[Tool](ctx, c, ToolsList, "tools", nil)
 	if err != nil {
-		return nil, fmt.Errorf("tools/list request failed: %w", err)
+		return nil, err
 	}
 
-	var result struct {
-		Tools []Tool `json:"tools"`
+	// Only cache the result if the list has not changed since it was requested
+	c.mu.Lock()
+	if c.toolsGen == gen {
+		c.tools = slices.Clone(tools)
+		c.toolsValid = true
 	}
-	if err := sonic.Unmarshal(response.Result, &result); err != nil {
-		return nil, fmt.Errorf("error unmarshaling tools list: %w", err)
+	c.mu.Unlock()
+
+	return tools, nil
+}
+
+// OnToolsChanged registers a callback that receives the re-fetched tools
+// list whenever the server reports that it has changed
+func (c *Client) OnToolsChanged(fn func([]Tool)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onToolsChanged = fn
+}
+
+// OnListChanged registers a callback that is called, on its own goroutine,
+// with PromptsListChanged or ResourcesListChanged whenever the server reports
+// that its prompts or resources have changed
+func (c *Client) OnListChanged(fn func(kind string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onListChanged = fn
+}
+
+// refreshTools drops the cached tools list and fetches it again
+func (c *Client) refreshTools() {
+	c.mu.Lock()
+	c.toolsGen++
+	c.toolsValid = false
+	c.tools = nil
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), toolsRefreshTimeout)
+	defer cancel()
+
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		return
 	}
 
-	return result.Tools, nil
+	c.mu.RLock()
+	fn := c.onToolsChanged
+	c.mu.RUnlock()
+	if fn != nil {
+		fn(tools)
+	}
 }
 
 // CallTool calls a tool on the server
-func (c *Client) CallTool(ctx context.Context, name string, arguments interface{}) (json.RawMessage, error) {
+func (c *Client) CallTool(ctx context.Context, name string, arguments interface{}, opts ...CallOption) (json.RawMessage, error) {
+	if err := c.requireCapability(ToolsCall); err != nil {
+		return nil, err
+	}
+
+	var options callOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	argsBytes, err := sonic.Marshal(arguments)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling arguments: %w", err)
@@ -121,6 +445,20 @@ func (c *Client) CallTool(ctx context.Context, name string, arguments interface{
 		Arguments: argsBytes,
 	}
 
+	if options.onProgress != nil {
+		params.ProgressToken = fmt.Sprintf("progress-%d", c.nextID.Add(1))
+
+		c.mu.Lock()
+		c.progress[params.ProgressToken] = options.onProgress
+		c.mu.Unlock()
+
+		defer func() {
+			c.mu.Lock()
+			delete(c.progress, params.ProgressToken)
+			c.mu.Unlock()
+		}()
+	}
+
 	paramsBytes, err := sonic.Marshal(params)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling params: %w", err)
@@ -134,71 +472,414 @@ func (c *Client) CallTool(ctx context.Context, name string, arguments interface{
 	return response.Result, nil
 }
 
-// Close closes the client connection
+// ListResources retrieves the resources available on the server, following
+// every page
+func (c *Client) ListResources(ctx context.Context, opts ...ListOption) ([]Resource, error) {
+	if err := c.requireCapability(ResourcesList); err != nil {
+		return nil, err
+	}
+	return listAll[Resource](ctx, c, ResourcesList, "resources", opts)
+}
+
+// ReadResource retrieves the contents of the resource at uri
+func (c *Client) ReadResource(ctx context.Context, uri string) (*ResourceContents, error) {
+	if err := c.requireCapability(ResourcesRead); err != nil {
+		return nil, err
+	}
+
+	params, err := sonic.Marshal(resourceParams{URI: uri})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling params: %w", err)
+	}
+
+	response, err := c.sendRequest(ctx, ResourcesRead, params)
+	if err != nil {
+		return nil, fmt.Errorf("resources/read request failed: %w", err)
+	}
+
+	var result struct {
+		Contents []ResourceContents `json:"contents"`
+	}
+	if err := sonic.Unmarshal(response.Result, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling resource: %w", err)
+	}
+	if len(result.Contents) == 0 {
+		return nil, fmt.Errorf("resources/read returned no contents for %s", uri)
+	}
+	return &result.Contents[0], nil
+}
+
+// WriteResource replaces the contents of the resource at contents.URI
+func (c *Client) WriteResource(ctx context.Context, contents ResourceContents) error {
+	if err := c.requireCapability(ResourcesWrite); err != nil {
+		return err
+	}
+
+	params, err := sonic.Marshal(contents)
+	if err != nil {
+		return fmt.Errorf("error marshaling params: %w", err)
+	}
+
+	if _, err := c.sendRequest(ctx, ResourcesWrite, params); err != nil {
+		return fmt.Errorf("resources/write request failed: %w", err)
+	}
+	return nil
+}
+
+// ListPrompts retrieves the prompts available on the server, following
+// every page
+func (c *Client) ListPrompts(ctx context.Context, opts ...ListOption) ([]Prompt, error) {
+	if err := c.requireCapability(PromptsList); err != nil {
+		return nil, err
+	}
+	return listAll[Prompt](ctx, c, PromptsList, "prompts", opts)
+}
+
+// RenderPrompt renders a prompt on the server with the given arguments
+func (c *Client) RenderPrompt(ctx context.Context, name string, arguments map[string]interface{}) (*PromptRenderResult, error) {
+	if err := c.requireCapability(PromptsRender); err != nil {
+		return nil, err
+	}
+
+	params, err := sonic.Marshal(PromptRenderParams{Name: name, Arguments: arguments})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling params: %w", err)
+	}
+
+	response, err := c.sendRequest(ctx, PromptsRender, params)
+	if err != nil {
+		return nil, fmt.Errorf("prompts/render request failed: %w", err)
+	}
+
+	var result PromptRenderResult
+	if err := sonic.Unmarshal(response.Result, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling rendered prompt: %w", err)
+	}
+	return &result, nil
+}
+
+// Ping checks that the server is responsive. It may be called before
+// Initialize.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.connectionError(); err != nil {
+		return err
+	}
+
+	if _, err := c.sendRequest(ctx, Ping, nil); err != nil {
+		return fmt.Errorf("ping request failed: %w", err)
+	}
+	return nil
+}
+
+// keepAlive pings the server every interval until the client is closed. A
+// ping that goes unanswered for a whole interval closes the transport, so a
+// hung connection is detected and, if enabled, re-established.
+func (c *Client) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closed:
+			return
+		case <-ticker.C:
+		}
+
+		if c.State() != StateConnected {
+			continue
+		}
+		conn := c.current()
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := c.Ping(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.log().Warn("MCP server did not answer ping, closing connection", "interval", interval)
+			conn.Close()
+		}
+	}
+}
+
+// Close closes the client connection and stops any reconnection attempts.
+// Pending requests fail with ErrClientClosed.
 func (c *Client) Close() error {
-	return c.conn.Close()
+	c.mu.Lock()
+	if c.state == StateClosed {
+		c.mu.Unlock()
+		return nil
+	}
+	conn := c.conn
+	c.state = StateClosed
+	c.lastErr = nil
+	fn := c.onStateChange
+	close(c.closed)
+	c.mu.Unlock()
+
+	if fn != nil {
+		fn(StateClosed, nil)
+	}
+	return conn.Close()
+}
+
+// current returns the connection requests are sent on
+func (c *Client) current() *connection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
 }
 
-func (c *Client) handleMessages() {
+// handleMessages reads from conn until it fails
+func (c *Client) handleMessages(conn *connection) {
 	for {
-		var msg MCPMessage
-		if err := c.conn.ReadJSON(&msg); err != nil {
-			// Handle connection closed
+		data, err := conn.ReadMessage()
+		if err != nil {
+			c.disconnected(conn, err)
 			return
 		}
 
-		if msg.Method == Notification {
-			if handler, ok := c.handlers[Notification]; ok {
-				go func() {
-					if _, err := handler(context.Background(), &msg); err != nil {
-						// Handle notification handler error
-					}
-				}()
+		// Requests the server batches are answered individually
+		if isBatch(data) {
+			var batch []MCPMessage
+			if err := sonic.Unmarshal(data, &batch); err != nil {
+				continue
+			}
+			for i := range batch {
+				c.receive(conn, &batch[i])
 			}
 			continue
 		}
 
+		var msg MCPMessage
+		if err := sonic.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		c.receive(conn, &msg)
+	}
+}
+
+// receive handles a message read from conn
+func (c *Client) receive(conn *connection, msg *MCPMessage) {
+	switch {
+	case msg.Method == "":
 		c.mu.RLock()
-		ch, ok := c.responses[msg.ID]
+		ch, ok := c.responses[idKey(msg.ID)]
 		c.mu.RUnlock()
 
 		if ok {
-			ch <- &msg
+			ch <- msg
 		}
+	case msg.ID == nil:
+		c.handleNotification(msg)
+	default:
+		c.handleRequest(conn, msg)
 	}
 }
 
-func (c *Client) sendRequest(ctx context.Context, method MCPMethod, params json.RawMessage) (*MCPMessage, error) {
-	id := c.nextID.Add(1)
-	ch := make(chan *MCPMessage, 1)
+// handleNotification runs the handler registered for a notification from
+// the server
+func (c *Client) handleNotification(msg *MCPMessage) {
+	switch msg.Method {
+	case Notification:
+		c.dispatchNotification(msg.Params)
+	case CancelRequest:
+		var params CancelParams
+		if err := sonic.Unmarshal(msg.Params, &params); err == nil {
+			c.mu.RLock()
+			cancel, ok := c.incoming[idKey(params.ID)]
+			c.mu.RUnlock()
+			if ok {
+				cancel()
+			}
+		}
+		return
+	}
+
+	c.mu.RLock()
+	handler, ok := c.handlers[msg.Method]
+	c.mu.RUnlock()
+	if ok {
+		handler = c.wrap(handler)
+		go func() {
+			if _, err := handler(context.Background(), msg); err != nil {
+				// Handle notification handler error
+			}
+		}()
+	}
+}
+
+// handleRequest answers a request from the server using the handler
+// registered for its method, replying on the connection it arrived on
+func (c *Client) handleRequest(conn Transport, msg *MCPMessage) {
+	c.mu.RLock()
+	handler, ok := c.handlers[msg.Method]
+	c.mu.RUnlock()
+
+	if !ok {
+		_ = writeJSON(conn, MCPMessage{
+			JSONRPC: "2.0",
+			ID:      msg.ID,
+			Error:   errorf(CodeMethodNotFound, nil, "method %s not found", msg.Method),
+		})
+		return
+	}
+	handler = c.wrap(handler)
 
+	key := idKey(msg.ID)
+	ctx, cancel := context.WithCancel(context.Background())
 	c.mu.Lock()
-	c.responses[id] = ch
+	c.incoming[key] = cancel
 	c.mu.Unlock()
 
-	defer func() {
-		c.mu.Lock()
-		delete(c.responses, id)
-		c.mu.Unlock()
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.incoming, key)
+			c.mu.Unlock()
+			cancel()
+		}()
+
+		response, err := handler(ctx, msg)
+		if ctx.Err() != nil {
+			// Cancelled by the server, which expects no response
+			return
+		}
+		if err != nil {
+			var mcpErr *MCPError
+			if !errors.As(err, &mcpErr) {
+				mcpErr = NewError(CodeServerError, err.Error(), nil)
+			}
+			response = &MCPMessage{JSONRPC: "2.0", ID: msg.ID, Error: mcpErr}
+		}
+		if response != nil {
+			_ = writeJSON(conn, response)
+		}
 	}()
+}
 
-	msg := MCPMessage{
+// handleRootsList reports the root URI passed to Initialize
+func (c *Client) handleRootsList(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	c.mu.RLock()
+	rootURI := c.rootURI
+	c.mu.RUnlock()
+
+	roots := []Root{}
+	if rootURI != "" {
+		roots = append(roots, Root{URI: rootURI})
+	}
+
+	result, err := sonic.Marshal(map[string]interface{}{
+		"roots": roots,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling roots: %w", err)
+	}
+
+	return &MCPMessage{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  result,
+	}, nil
+}
+
+// dispatchNotification handles the notification types the client tracks
+// itself: progress for in-flight calls and list changes for cached lists
+func (c *Client) dispatchNotification(params json.RawMessage) {
+	var notification struct {
+		Type    string          `json:"type"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := sonic.Unmarshal(params, &notification); err != nil {
+		return
+	}
+
+	switch notification.Type {
+	case ProgressNotification:
+		var progress ProgressParams
+		if err := sonic.Unmarshal(notification.Data, &progress); err != nil {
+			return
+		}
+
+		c.mu.RLock()
+		fn, ok := c.progress[progress.Token]
+		c.mu.RUnlock()
+
+		if ok {
+			fn(progress.Progress, progress.Total, notification.Message)
+		}
+	case ToolsListChanged:
+		// Re-fetching needs the read loop, so it cannot run on it
+		go c.refreshTools()
+	case PromptsListChanged, ResourcesListChanged:
+		c.mu.RLock()
+		fn := c.onListChanged
+		c.mu.RUnlock()
+
+		// The callback may list again, which needs the read loop
+		if fn != nil {
+			go fn(notification.Type)
+		}
+	case ResourceUpdated:
+		c.resourceUpdated(notification.Data)
+	case LogNotification:
+		c.logReceived(notification.Data)
+	}
+}
+
+func (c *Client) sendRequest(ctx context.Context, method MCPMethod, params json.RawMessage) (*MCPMessage, error) {
+	msg := &MCPMessage{
 		JSONRPC: "2.0",
-		ID:      id,
 		Method:  method,
 		Params:  params,
 	}
+	return c.wrap(c.roundTrip)(ctx, msg)
+}
 
-	if err := c.conn.WriteJSON(msg); err != nil {
+// roundTrip sends a request to the server and waits for its response
+func (c *Client) roundTrip(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	conn := c.current()
+	ch, done := c.expect(msg)
+	defer done()
+
+	if err := writeJSON(conn, msg); err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
+	return c.await(ctx, conn, msg.ID, ch)
+}
+
+// expect gives msg a new ID and registers a channel for the response to it.
+// The returned function unregisters the channel.
+func (c *Client) expect(msg *MCPMessage) (<-chan *MCPMessage, func()) {
+	id := c.nextID.Add(1)
+	key := idKey(id)
+	ch := make(chan *MCPMessage, 1)
+
+	c.mu.Lock()
+	c.responses[key] = ch
+	c.mu.Unlock()
+
+	msg.ID = id
+	return ch, func() {
+		c.mu.Lock()
+		delete(c.responses, key)
+		c.mu.Unlock()
+	}
+}
 
+// await waits for the response to the request with the given ID sent on conn
+func (c *Client) await(ctx context.Context, conn *connection, id interface{}, ch <-chan *MCPMessage) (*MCPMessage, error) {
 	select {
 	case <-ctx.Done():
+		// Let the server stop work on the abandoned request
+		if params, err := sonic.Marshal(CancelParams{ID: id}); err == nil {
+			_ = writeJSON(conn, MCPMessage{JSONRPC: "2.0", Method: CancelRequest, Params: params})
+		}
 		return nil, ctx.Err()
+	case <-conn.lost:
+		return nil, conn.err
 	case response := <-ch:
 		if response.Error != nil {
-			return nil, fmt.Errorf("server error: %s", response.Error.Message)
+			return nil, response.Error
 		}
 		return response, nil
 	}
@@ -211,10 +892,21 @@ func (c *Client) sendNotification(method MCPMethod, params json.RawMessage) erro
 		Params:  params,
 	}
 
-	return c.conn.WriteJSON(msg)
+	return writeJSON(c.current(), msg)
+}
+
+// RegisterHandler registers a handler for requests or notifications the
+// server sends with the given method. Handlers for requests return the
+// response to send back.
+func (c *Client) RegisterHandler(method MCPMethod, handler HandlerFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[method] = handler
 }
 
 // RegisterNotificationHandler registers a handler for notifications
 func (c *Client) RegisterNotificationHandler(handler HandlerFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.handlers[Notification] = handler
 }
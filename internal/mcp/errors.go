@@ -0,0 +1,71 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import "fmt"
+
+// JSON-RPC error codes, followed by the codes MCP defines in the range
+// JSON-RPC reserves for implementation-defined server errors
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	CodeServerError      = -32000 // a handler failed
+	CodeUnauthorized     = -32001
+	CodeNotInitialized   = -32002
+	CodeForbidden        = -32003
+	CodeToolNotFound     = -32004
+	CodeResourceNotFound = -32005
+	CodePromptNotFound   = -32006
+	CodeRequestDeclined  = -32007 // the receiver refused, e.g. a sampling request the host did not approve
+)
+
+// Sentinel errors for each code. An MCPError matches the sentinel with the
+// same code under errors.Is, whatever its message or data, including errors
+// the client decoded from a server response.
+var (
+	ErrParse                = &MCPError{Code: CodeParseError, Message: "parse error"}
+	ErrInvalidRequest       = &MCPError{Code: CodeInvalidRequest, Message: "invalid request"}
+	ErrMethodNotFound       = &MCPError{Code: CodeMethodNotFound, Message: "method not found"}
+	ErrInvalidParams        = &MCPError{Code: CodeInvalidParams, Message: "invalid params"}
+	ErrInternal             = &MCPError{Code: CodeInternalError, Message: "internal error"}
+	ErrServer               = &MCPError{Code: CodeServerError, Message: "server error"}
+	ErrUnauthorized         = &MCPError{Code: CodeUnauthorized, Message: "unauthorized"}
+	ErrServerNotInitialized = &MCPError{Code: CodeNotInitialized, Message: "server not initialized"}
+	ErrForbidden            = &MCPError{Code: CodeForbidden, Message: "forbidden"}
+	ErrToolNotFound         = &MCPError{Code: CodeToolNotFound, Message: "tool not found"}
+	ErrResourceNotFound     = &MCPError{Code: CodeResourceNotFound, Message: "resource not found"}
+	ErrPromptNotFound       = &MCPError{Code: CodePromptNotFound, Message: "prompt not found"}
+	ErrRequestDeclined      = &MCPError{Code: CodeRequestDeclined, Message: "request declined"}
+)
+
+// NewError returns an error that is sent to the client with the given code,
+// message and data when returned from a handler
+func NewError(code int, message string, data interface{}) *MCPError {
+	return &MCPError{Code: code, Message: message, Data: data}
+}
+
+// errorf returns an MCPError with a formatted message
+func errorf(code int, data interface{}, format string, args ...interface{}) *MCPError {
+	return &MCPError{Code: code, Message: fmt.Sprintf(format, args...), Data: data}
+}
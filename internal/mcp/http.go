@@ -0,0 +1,81 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultPath is the HTTP path the MCP endpoint is served on
+const DefaultPath = "/mcp"
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// ServeHTTP serves MCP over HTTP. WebSocket upgrade requests are served on
+// the upgraded connection. Otherwise a GET opens a server-sent event stream
+// for a new session, identified by the SessionIDHeader response header and
+// the URL in the stream's first event, named endpoint; requests for that
+// session are POSTed with the same header or to that URL and their responses
+// delivered on the stream, and a DELETE ends the session.
+//
+// If the server has an authenticator, credentials on the request are checked
+// before anything else and rejected with 401 Unauthorized if invalid.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	principal, err := s.authenticateRequest(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mcp"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade has already written an HTTP error response
+			s.log().Error("error upgrading connection", "err", err)
+			return
+		}
+
+		s.handleConnection(conn, principal)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			http.Error(w, "websocket upgrade or text/event-stream required", http.StatusNotAcceptable)
+			return
+		}
+		s.serveSSE(w, r, principal)
+	case http.MethodPost:
+		s.handleSSEPost(w, r, principal)
+	case http.MethodDelete:
+		s.handleSSEDelete(w, r, principal)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
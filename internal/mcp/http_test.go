@@ -0,0 +1,72 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebSocketShutdownDrains(t *testing.T) {
+	s := NewServer()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	err := s.RegisterTool(Tool{Name: "slow"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		close(started)
+		<-release
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newHTTPServer(t, s)
+
+	client, err := NewClientWithConfig("ws"+strings.TrimPrefix(ts.URL, "http")+DefaultPath, ClientConfig{})
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Initialize(ctx, ""); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	type callResult struct {
+		result json.RawMessage
+		err    error
+	}
+	call := make(chan callResult, 1)
+	go func() {
+		result, err := client.CallTool(ctx, "slow", nil)
+		call <- callResult{result, err}
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(ctx)
+	}()
+
+	// Shutdown waits for the in-flight call
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown() returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	got := <-call
+	if got.err != nil || string(got.result) != `"done"` {
+		t.Fatalf("CallTool() = %s, %v, want the response before the connection closed", got.result, got.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+
+	waitFor(t, "the connection to close", func() bool {
+		return client.State() != StateConnected
+	})
+}
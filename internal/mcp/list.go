@@ -0,0 +1,214 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// DefaultPageSize is the number of items a list response holds unless
+// overridden with WithPageSize or a smaller request limit
+const DefaultPageSize = 100
+
+// ListParams are the parameters of tools/list, resources/list and
+// prompts/list. All are optional.
+type ListParams struct {
+	// Cursor is the nextCursor of the previous page
+	Cursor string `json:"cursor,omitempty"`
+	// Limit caps the page size below the server's own
+	Limit int `json:"limit,omitempty"`
+	// Name keeps items whose name, or URI for resources, matches. A
+	// trailing * matches any suffix.
+	Name string `json:"name,omitempty"`
+	// Tags keeps items carrying every one of the tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+// matches reports whether an item with the given names and tags passes the
+// filters
+func (p ListParams) matches(tags []string, names ...string) bool {
+	for _, tag := range p.Tags {
+		if !slices.Contains(tags, tag) {
+			return false
+		}
+	}
+	if p.Name == "" {
+		return true
+	}
+	return slices.ContainsFunc(names, func(name string) bool {
+		return name != "" && matchPattern(p.Name, name)
+	})
+}
+
+// WithPageSize sets the maximum number of items in a list response
+func (s *Server) WithPageSize(size int) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = size
+	return s
+}
+
+// listParams decodes the parameters of a list request, which may be absent
+func (s *Server) listParams(msg *MCPMessage) (ListParams, int, error) {
+	var params ListParams
+	if len(msg.Params) > 0 && string(msg.Params) != "null" {
+		if err := sonic.Unmarshal(msg.Params, &params); err != nil {
+			return params, 0, NewError(CodeInvalidParams, "invalid list params", err.Error())
+		}
+	}
+
+	s.mu.RLock()
+	size := s.pageSize
+	s.mu.RUnlock()
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	if params.Limit > 0 && params.Limit < size {
+		size = params.Limit
+	}
+	return params, size, nil
+}
+
+// paginate sorts items by key, drops those that fail keep and returns the
+// page following cursor with the cursor of the next page, if any. Cursors
+// name the last key returned, so pages stay consistent while items are added
+// or removed.
+func paginate[T any](items []T, cursor string, size int, key func(T) string, keep func(T) bool) ([]T, string, error) {
+	after := ""
+	if cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, "", NewError(CodeInvalidParams, "invalid cursor", cursor)
+		}
+		after = string(decoded)
+	}
+
+	slices.SortStableFunc(items, func(a, b T) int {
+		return strings.Compare(key(a), key(b))
+	})
+
+	page := make([]T, 0, min(size, len(items)))
+	for _, item := range items {
+		if cursor != "" && key(item) <= after {
+			continue
+		}
+		if !keep(item) {
+			continue
+		}
+		if len(page) == size {
+			last := key(page[len(page)-1])
+			return page, base64.RawURLEncoding.EncodeToString([]byte(last)), nil
+		}
+		page = append(page, item)
+	}
+	return page, "", nil
+}
+
+// listResponse builds the response to a list request
+func listResponse(msg *MCPMessage, field string, page interface{}, next string) (*MCPMessage, error) {
+	body := map[string]interface{}{field: page}
+	if next != "" {
+		body["nextCursor"] = next
+	}
+
+	result, err := sonic.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling %s: %w", field, err)
+	}
+
+	return &MCPMessage{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  result,
+	}, nil
+}
+
+// ListOption filters the results of a client list call
+type ListOption func(*ListParams)
+
+// WithNameFilter keeps items whose name, or URI for resources, matches
+// pattern. A trailing * matches any suffix.
+func WithNameFilter(pattern string) ListOption {
+	return func(p *ListParams) {
+		p.Name = pattern
+	}
+}
+
+// WithTags keeps items carrying every one of tags
+func WithTags(tags ...string) ListOption {
+	return func(p *ListParams) {
+		p.Tags = append(p.Tags, tags...)
+	}
+}
+
+// listAll requests every page of a list method and returns the items held
+// in field
+func listAll[T any](ctx context.Context, c *Client, method MCPMethod, field string, opts []ListOption) ([]T, error) {
+	var params ListParams
+	for _, opt := range opts {
+		opt(&params)
+	}
+
+	items := []T{}
+	seen := make(map[string]bool)
+	for {
+		raw, err := sonic.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling params: %w", err)
+		}
+
+		response, err := c.sendRequest(ctx, method, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s request failed: %w", method, err)
+		}
+
+		var result map[string]json.RawMessage
+		if err := sonic.Unmarshal(response.Result, &result); err != nil {
+			return nil, fmt.Errorf("error unmarshaling %s: %w", field, err)
+		}
+		var page []T
+		if err := sonic.Unmarshal(result[field], &page); err != nil {
+			return nil, fmt.Errorf("error unmarshaling %s: %w", field, err)
+		}
+		items = append(items, page...)
+
+		var next string
+		if raw, ok := result["nextCursor"]; ok {
+			if err := sonic.Unmarshal(raw, &next); err != nil {
+				return nil, fmt.Errorf("error unmarshaling cursor: %w", err)
+			}
+		}
+		if next == "" {
+			return items, nil
+		}
+		if seen[next] {
+			return nil, fmt.Errorf("%s returned cursor %q twice", method, next)
+		}
+		seen[next] = true
+		params.Cursor = next
+	}
+}
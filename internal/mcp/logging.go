@@ -0,0 +1,289 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/bytedance/sonic"
+)
+
+// LogParams is the payload of a log notification. Attrs holds the record's
+// attributes, with group names joined to keys by dots.
+type LogParams struct {
+	Level   slog.Level             `json:"level"`
+	Message string                 `json:"message"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// SetLevelParams represents parameters for a logging/setLevel request
+type SetLevelParams struct {
+	Level slog.Level `json:"level"`
+}
+
+// LogFunc receives the log records a server sends the client
+type LogFunc func(record LogParams)
+
+// loggerKey is the context key for a request's logger
+type loggerKey struct{}
+
+// LoggerFromContext returns the logger for the request being handled under
+// ctx. Records go to the server's local handler and, at or above the level
+// the client set with logging/setLevel, to the client as log notifications.
+// Outside a request it returns slog.Default().
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// withLogger attaches logger to ctx
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// WithLogger sends the server's own log records, and those of its handlers,
+// to handler instead of slog.Default()
+func (s *Server) WithLogger(handler slog.Handler) *Server {
+	s.logger.Store(slog.New(handler))
+	return s
+}
+
+// log returns the server's local logger
+func (s *Server) log() *slog.Logger {
+	return s.logger.Load()
+}
+
+// WithLogger sends the client's own log records to handler instead of
+// slog.Default(). Records the server sends are delivered to OnLog.
+func (c *Client) WithLogger(handler slog.Handler) *Client {
+	c.logger.Store(slog.New(handler))
+	return c
+}
+
+// log returns the client's local logger
+func (c *Client) log() *slog.Logger {
+	return c.logger.Load()
+}
+
+// sessionLogger returns a logger for handlers serving client
+func (s *Server) sessionLogger(client *ClientState) *slog.Logger {
+	return slog.New(&sessionHandler{
+		local:  s.log().Handler(),
+		server: s,
+		client: client,
+	})
+}
+
+func (s *Server) handleLoggingSetLevel(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	var params SetLevelParams
+	if err := sonic.Unmarshal(msg.Params, &params); err != nil {
+		return nil, NewError(CodeInvalidParams, "invalid log level params", err.Error())
+	}
+
+	s.mu.Lock()
+	if client, ok := s.clients[msg.Conn]; ok {
+		client.logLevel = &params.Level
+	}
+	s.mu.Unlock()
+
+	return &MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: []byte(`{}`)}, nil
+}
+
+// sessionHandler is a slog.Handler that writes records to the server's
+// local handler and forwards them to a client
+type sessionHandler struct {
+	local  slog.Handler
+	server *Server
+	client *ClientState
+	// attrs are the attributes added with WithAttrs, keyed by their
+	// qualified names; prefix qualifies the names of those still to come
+	attrs  []slog.Attr
+	prefix string
+}
+
+// clientLevel returns the client's minimum level and whether it asked for
+// log records at all
+func (h *sessionHandler) clientLevel() (slog.Level, bool) {
+	h.server.mu.RLock()
+	defer h.server.mu.RUnlock()
+	if h.client.logLevel == nil {
+		return 0, false
+	}
+	return *h.client.logLevel, true
+}
+
+// Enabled implements slog.Handler
+func (h *sessionHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.local.Enabled(ctx, level) {
+		return true
+	}
+	minLevel, ok := h.clientLevel()
+	return ok && level >= minLevel
+}
+
+// Handle implements slog.Handler. Failing to reach the client is not an
+// error, since the connection may already be gone.
+func (h *sessionHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.local.Enabled(ctx, r.Level) {
+		err = h.local.Handle(ctx, r)
+	}
+
+	if minLevel, ok := h.clientLevel(); !ok || r.Level < minLevel {
+		return err
+	}
+
+	attrs := make(map[string]interface{}, len(h.attrs)+r.NumAttrs())
+	for _, a := range h.attrs {
+		addAttr(attrs, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(attrs, h.prefix, a)
+		return true
+	})
+	if len(attrs) == 0 {
+		attrs = nil
+	}
+
+	_ = h.server.Notify(h.client, NotificationParams{
+		Type:    LogNotification,
+		Message: r.Message,
+		Data:    LogParams{Level: r.Level, Message: r.Message, Attrs: attrs},
+	})
+	return err
+}
+
+// WithAttrs implements slog.Handler
+func (h *sessionHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.local = h.local.WithAttrs(attrs)
+	clone.attrs = slices.Clip(h.attrs)
+	for _, a := range attrs {
+		a.Key = h.prefix + a.Key
+		clone.attrs = append(clone.attrs, a)
+	}
+	return &clone
+}
+
+// WithGroup implements slog.Handler
+func (h *sessionHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.local = h.local.WithGroup(name)
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// addAttr adds a to attrs under its qualified name, flattening groups
+func addAttr(attrs map[string]interface{}, prefix string, a slog.Attr) {
+	value := a.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = prefix + a.Key + "."
+		}
+		for _, member := range value.Group() {
+			addAttr(attrs, groupPrefix, member)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+
+	key := strings.TrimSuffix(prefix+a.Key, ".")
+	switch v := value.Any().(type) {
+	case error:
+		attrs[key] = v.Error()
+	default:
+		attrs[key] = v
+	}
+}
+
+// SetLogLevel asks the server to send log records at or above level to
+// the client. Records are delivered to the callback set with OnLog.
+func (c *Client) SetLogLevel(ctx context.Context, level slog.Level) error {
+	if err := c.requireCapability(LoggingSetLevel); err != nil {
+		return err
+	}
+
+	params, err := sonic.Marshal(SetLevelParams{Level: level})
+	if err != nil {
+		return fmt.Errorf("error marshaling params: %w", err)
+	}
+	if _, err := c.sendRequest(ctx, LoggingSetLevel, params); err != nil {
+		return fmt.Errorf("logging/setLevel request failed: %w", err)
+	}
+
+	c.mu.Lock()
+	c.logLevel = &level
+	c.mu.Unlock()
+	return nil
+}
+
+// restoreLogLevel requests the log level set with SetLogLevel on a new
+// connection
+func (c *Client) restoreLogLevel(ctx context.Context) error {
+	c.mu.RLock()
+	level := c.logLevel
+	c.mu.RUnlock()
+	if level == nil {
+		return nil
+	}
+
+	params, err := sonic.Marshal(SetLevelParams{Level: *level})
+	if err != nil {
+		return fmt.Errorf("error marshaling params: %w", err)
+	}
+	if _, err := c.sendRequest(ctx, LoggingSetLevel, params); err != nil {
+		return fmt.Errorf("error restoring log level: %w", err)
+	}
+	return nil
+}
+
+// OnLog registers a callback for the log records the server sends
+func (c *Client) OnLog(fn LogFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onLog = fn
+}
+
+// logReceived delivers a log notification to the registered callback
+func (c *Client) logReceived(data []byte) {
+	var params LogParams
+	if err := sonic.Unmarshal(data, &params); err != nil {
+		return
+	}
+
+	c.mu.RLock()
+	fn := c.onLog
+	c.mu.RUnlock()
+	if fn != nil {
+		fn(params)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+)
+
+// Middleware wraps a HandlerFunc to act before and after it, or instead of
+// it. Middleware may rewrite the message, the response or the error.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// chain wraps handler in middleware, the first being outermost
+func chain(handler HandlerFunc, middleware []Middleware) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Recover returns middleware that turns a panic in a handler into an
+// internal error instead of crashing the process
+func Recover() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *MCPMessage) (response *MCPMessage, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					LoggerFromContext(ctx).Error("handler panicked", "method", msg.Method, "panic", r)
+					response, err = nil, errorf(CodeInternalError, nil, "%s handler panicked", msg.Method)
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Use adds middleware around every request and notification handler,
+// including those registered later. Middleware added first runs first.
+func (s *Server) Use(middleware ...Middleware) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.middleware = append(s.middleware, middleware...)
+	return s
+}
+
+// RegisterHandler registers a handler for requests or notifications with
+// the given method, which may be a custom method or replace a built-in one
+func (s *Server) RegisterHandler(method MCPMethod, handler HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = handler
+}
+
+// handler returns the handler for method wrapped in the server's middleware
+func (s *Server) handler(method MCPMethod) (HandlerFunc, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	handler, ok := s.handlers[method]
+	if !ok {
+		return nil, false
+	}
+	return chain(handler, s.middleware), true
+}
+
+// Use adds middleware around the requests the client sends, whose innermost
+// handler performs the round trip to the server, and around the handlers for
+// requests and notifications it receives. Middleware added first runs first.
+func (c *Client) Use(middleware ...Middleware) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.middleware = append(c.middleware, middleware...)
+	return c
+}
+
+// wrap returns handler wrapped in the client's middleware
+func (c *Client) wrap(handler HandlerFunc) HandlerFunc {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return chain(handler, c.middleware)
+}
+
+// Call sends a request with any method, such as a custom method the server
+// registered with RegisterHandler, and returns its result
+func (c *Client) Call(ctx context.Context, method MCPMethod, params interface{}) (json.RawMessage, error) {
+	if err := c.requireCapability(method); err != nil {
+		return nil, err
+	}
+
+	var paramsBytes []byte
+	if params != nil {
+		var err error
+		if paramsBytes, err = sonic.Marshal(params); err != nil {
+			return nil, fmt.Errorf("error marshaling params: %w", err)
+		}
+	}
+
+	response, err := c.sendRequest(ctx, method, paramsBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", method, err)
+	}
+	return response.Result, nil
+}
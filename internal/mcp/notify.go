@@ -0,0 +1,179 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+)
+
+// ErrClientDisconnected is returned when a client disconnects before
+// answering a server-initiated request
+var ErrClientDisconnected = errors.New("client disconnected")
+
+// Clients returns the currently connected clients
+func (s *Server) Clients() []*ClientState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := make([]*ClientState, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// Notify sends a notification to a single client
+func (s *Server) Notify(client *ClientState, params NotificationParams) error {
+	paramsBytes, err := sonic.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("error marshaling notification: %w", err)
+	}
+
+	return writeJSON(client.conn, MCPMessage{
+		JSONRPC: "2.0",
+		Method:  Notification,
+		Params:  paramsBytes,
+	})
+}
+
+// Broadcast sends a notification to every client that has completed
+// initialization. It attempts every client and returns the errors joined.
+func (s *Server) Broadcast(params NotificationParams) error {
+	s.mu.RLock()
+	clients := make([]*ClientState, 0, len(s.clients))
+	for _, client := range s.clients {
+		if client.Initialized {
+			clients = append(clients, client)
+		}
+	}
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, client := range clients {
+		if err := s.Notify(client, params); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Request sends a request to a client and waits for its response. If ctx is
+// done first, the client is sent a $/cancelRequest for it.
+func (s *Server) Request(ctx context.Context, client *ClientState, method MCPMethod, params interface{}) (*MCPMessage, error) {
+	var paramsBytes []byte
+	if params != nil {
+		var err error
+		if paramsBytes, err = sonic.Marshal(params); err != nil {
+			return nil, fmt.Errorf("error marshaling params: %w", err)
+		}
+	}
+
+	id := s.nextID.Add(1)
+	key := idKey(id)
+	ch := make(chan *MCPMessage, 1)
+
+	s.mu.Lock()
+	client.pending[key] = ch
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(client.pending, key)
+		s.mu.Unlock()
+	}()
+
+	err := writeJSON(client.conn, MCPMessage{
+		JSONRPC: "2.0",
+		ID:      id,
+		Method:  method,
+		Params:  paramsBytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		if cancelParams, err := sonic.Marshal(CancelParams{ID: id}); err == nil {
+			_ = writeJSON(client.conn, MCPMessage{
+				JSONRPC: "2.0",
+				Method:  CancelRequest,
+				Params:  cancelParams,
+			})
+		}
+		return nil, ctx.Err()
+	case <-client.done:
+		return nil, ErrClientDisconnected
+	case response := <-ch:
+		if response.Error != nil {
+			return nil, response.Error
+		}
+		return response, nil
+	}
+}
+
+// ListRoots asks a client for the roots it exposes to the server
+func (s *Server) ListRoots(ctx context.Context, client *ClientState) ([]Root, error) {
+	response, err := s.Request(ctx, client, RootsList, nil)
+	if err != nil {
+		return nil, fmt.Errorf("roots/list request failed: %w", err)
+	}
+
+	var result struct {
+		Roots []Root `json:"roots"`
+	}
+	if err := sonic.Unmarshal(response.Result, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling roots: %w", err)
+	}
+
+	return result.Roots, nil
+}
+
+// notifyListChanged tells initialized clients that a registry changed.
+// Failures are only logged since the change itself has already been made.
+func (s *Server) notifyListChanged(kind string) {
+	err := s.Broadcast(NotificationParams{
+		Type:    kind,
+		Message: kind,
+	})
+	if err != nil {
+		s.log().Error("error sending notification", "type", kind, "err", err)
+	}
+}
+
+// deliverResponse routes a client's response to the server request awaiting it
+func (s *Server) deliverResponse(client *ClientState, msg *MCPMessage) {
+	s.mu.RLock()
+	ch, ok := client.pending[idKey(msg.ID)]
+	s.mu.RUnlock()
+
+	// The request may have been abandoned already; ch is buffered and each ID
+	// is answered once
+	if ok {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
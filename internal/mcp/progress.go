@@ -0,0 +1,80 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+)
+
+// progressKey is the context key for a request's ProgressReporter
+type progressKey struct{}
+
+// ProgressReporter sends progress notifications for a single request. A nil
+// reporter, or one for a request that did not ask for progress, discards
+// reports.
+type ProgressReporter struct {
+	conn  Transport
+	token string
+}
+
+// ProgressFromContext returns the progress reporter for the request being
+// handled under ctx. It never returns nil, so handlers can report
+// unconditionally.
+func ProgressFromContext(ctx context.Context) *ProgressReporter {
+	if reporter, ok := ctx.Value(progressKey{}).(*ProgressReporter); ok {
+		return reporter
+	}
+	return &ProgressReporter{}
+}
+
+// withProgress attaches a reporter for token to ctx
+func withProgress(ctx context.Context, conn Transport, token string) context.Context {
+	return context.WithValue(ctx, progressKey{}, &ProgressReporter{conn: conn, token: token})
+}
+
+// Report sends the current progress of the request, with total set to zero
+// if the amount of work is unknown
+func (p *ProgressReporter) Report(progress, total float64, message string) error {
+	if p == nil || p.conn == nil || p.token == "" {
+		return nil
+	}
+
+	params, err := sonic.Marshal(NotificationParams{
+		Type:    ProgressNotification,
+		Message: message,
+		Data: ProgressParams{
+			Token:    p.token,
+			Progress: progress,
+			Total:    total,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling progress: %w", err)
+	}
+
+	return writeJSON(p.conn, MCPMessage{
+		JSONRPC: "2.0",
+		Method:  Notification,
+		Params:  params,
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Roles of the messages a rendered prompt is made of
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// PromptHandler renders a prompt registered with RegisterPromptHandler.
+// Required arguments have been checked before it is called.
+type PromptHandler func(ctx context.Context, arguments map[string]interface{}) (*PromptRenderResult, error)
+
+// registeredPrompt pairs a prompt definition with its parsed message
+// templates, or with the handler that renders it
+type registeredPrompt struct {
+	Prompt
+	messages []promptTemplate
+	handler  PromptHandler
+}
+
+// promptTemplate is the parsed template of a prompt message
+type promptTemplate struct {
+	role     string
+	template *template.Template
+}
+
+// newRegisteredPrompt validates a prompt definition and parses its templates
+// unless it has a handler. A prompt with only a Template renders to a single
+// user message. Templates may only refer to declared arguments and to
+// Variables.
+func newRegisteredPrompt(prompt Prompt, handler PromptHandler) (registeredPrompt, error) {
+	declared := make(map[string]bool, len(prompt.Arguments))
+	for _, arg := range prompt.Arguments {
+		if arg.Name == "" {
+			return registeredPrompt{}, fmt.Errorf("prompt %s has an unnamed argument", prompt.Name)
+		}
+		if declared[arg.Name] {
+			return registeredPrompt{}, fmt.Errorf("prompt %s declares argument %s twice", prompt.Name, arg.Name)
+		}
+		declared[arg.Name] = true
+	}
+	for name := range prompt.Variables {
+		declared[name] = true
+	}
+	if handler != nil {
+		return registeredPrompt{Prompt: prompt, handler: handler}, nil
+	}
+
+	messages := prompt.Messages
+	if len(messages) == 0 {
+		if prompt.Template == "" {
+			return registeredPrompt{}, fmt.Errorf("prompt %s has no template", prompt.Name)
+		}
+		messages = []PromptMessage{{Role: RoleUser, Content: prompt.Template}}
+	}
+
+	templates := make([]promptTemplate, 0, len(messages))
+	for i, message := range messages {
+		switch message.Role {
+		case RoleSystem, RoleUser, RoleAssistant:
+		default:
+			return registeredPrompt{}, fmt.Errorf("prompt %s message %d has unknown role %q", prompt.Name, i, message.Role)
+		}
+
+		tmpl, err := template.New(prompt.Name).Option("missingkey=error").Parse(message.Content)
+		if err != nil {
+			return registeredPrompt{}, fmt.Errorf("prompt %s message %d: invalid template: %w", prompt.Name, i, err)
+		}
+		for _, t := range tmpl.Templates() {
+			if name, ok := undeclaredField(t.Tree.Root, declared, true); ok {
+				return registeredPrompt{}, fmt.Errorf("prompt %s message %d refers to undeclared argument %s", prompt.Name, i, name)
+			}
+		}
+		templates = append(templates, promptTemplate{role: message.Role, template: tmpl})
+	}
+
+	return registeredPrompt{Prompt: prompt, messages: templates}, nil
+}
+
+// render renders the prompt with the given arguments, through its handler
+// or by executing its templates. Declared arguments that are not supplied
+// take their default from Variables, or are empty; required arguments
+// without a default must be supplied.
+func (p registeredPrompt) render(ctx context.Context, arguments map[string]interface{}) (*PromptRenderResult, error) {
+	var missing []string
+	for _, arg := range p.Arguments {
+		_, supplied := arguments[arg.Name]
+		_, defaulted := p.Variables[arg.Name]
+		if arg.Required && !supplied && !defaulted {
+			missing = append(missing, arg.Name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		data := map[string]interface{}{"prompt": p.Name, "missing": missing}
+		return nil, errorf(CodeInvalidParams, data, "prompt %s is missing required arguments %v", p.Name, missing)
+	}
+
+	if p.handler != nil {
+		result, err := p.handler(ctx, arguments)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			return nil, errorf(CodeInternalError, map[string]interface{}{"prompt": p.Name}, "prompt %s handler returned no result", p.Name)
+		}
+		if result.Description == "" {
+			result.Description = p.Description
+		}
+		return result, nil
+	}
+
+	vars := make(map[string]string, len(p.Arguments)+len(arguments))
+	for _, arg := range p.Arguments {
+		vars[arg.Name] = ""
+	}
+	for name, value := range p.Variables {
+		vars[name] = fmt.Sprint(value)
+	}
+	for name, value := range arguments {
+		vars[name] = fmt.Sprint(value)
+	}
+
+	messages := make([]PromptMessage, 0, len(p.messages))
+	for _, message := range p.messages {
+		var content strings.Builder
+		if err := message.template.Execute(&content, vars); err != nil {
+			return nil, errorf(CodeInternalError, map[string]interface{}{"prompt": p.Name}, "error rendering prompt %s: %v", p.Name, err)
+		}
+		messages = append(messages, PromptMessage{Role: message.role, Content: content.String()})
+	}
+	return &PromptRenderResult{Description: p.Description, Messages: messages}, nil
+}
+
+// undeclaredField returns the first field of the template data referred to
+// under node that is not declared. Fields under range and with, where dot is
+// no longer the data, are only checked when reached through $.
+func undeclaredField(node parse.Node, declared map[string]bool, atData bool) (string, bool) {
+	var children []parse.Node
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			children = n.Nodes
+		}
+	case *parse.ActionNode:
+		children = []parse.Node{n.Pipe}
+	case *parse.TemplateNode:
+		children = []parse.Node{n.Pipe}
+	case *parse.PipeNode:
+		if n == nil {
+			break
+		}
+		for _, cmd := range n.Cmds {
+			children = append(children, cmd.Args...)
+		}
+	case *parse.ChainNode:
+		children = []parse.Node{n.Node}
+	case *parse.IfNode:
+		return undeclaredInBranch(&n.BranchNode, declared, atData, atData)
+	case *parse.RangeNode:
+		return undeclaredInBranch(&n.BranchNode, declared, atData, false)
+	case *parse.WithNode:
+		return undeclaredInBranch(&n.BranchNode, declared, atData, false)
+	case *parse.FieldNode:
+		if atData && !declared[n.Ident[0]] {
+			return n.Ident[0], true
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" && !declared[n.Ident[1]] {
+			return n.Ident[1], true
+		}
+	}
+
+	for _, child := range children {
+		if name, ok := undeclaredField(child, declared, atData); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// undeclaredInBranch checks an if, range or with, whose body is run with
+// dot as the data only if bodyAtData is set
+func undeclaredInBranch(n *parse.BranchNode, declared map[string]bool, atData, bodyAtData bool) (string, bool) {
+	if name, ok := undeclaredField(n.Pipe, declared, atData); ok {
+		return name, true
+	}
+	if name, ok := undeclaredField(n.List, declared, bodyAtData); ok {
+		return name, true
+	}
+	return undeclaredField(n.ElseList, declared, atData)
+}
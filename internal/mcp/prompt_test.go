@@ -0,0 +1,90 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPromptHandlerResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler PromptHandler
+		want    string
+		wantErr error
+	}{
+		{
+			name: "result",
+			handler: func(ctx context.Context, arguments map[string]interface{}) (*PromptRenderResult, error) {
+				return &PromptRenderResult{Messages: []PromptMessage{{Role: RoleUser, Content: "hi"}}}, nil
+			},
+			want: "a greeting",
+		},
+		{
+			name: "nil result",
+			handler: func(ctx context.Context, arguments map[string]interface{}) (*PromptRenderResult, error) {
+				return nil, nil
+			},
+			wantErr: ErrInternal,
+		},
+		{
+			name: "error",
+			handler: func(ctx context.Context, arguments map[string]interface{}) (*PromptRenderResult, error) {
+				return nil, ErrForbidden
+			},
+			wantErr: ErrForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt, err := newRegisteredPrompt(Prompt{Name: "greet", Description: "a greeting"}, tt.handler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := prompt.render(context.Background(), nil)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("render() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("render() error = %v", err)
+			}
+			if result.Description != tt.want {
+				t.Errorf("render() description = %q, want %q", result.Description, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptTemplateReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{name: "declared argument", template: "Review {{.diff}}"},
+		{name: "variable", template: "You review {{.language}} code."},
+		{name: "undeclared argument", template: "Review {{.patch}}", wantErr: true},
+		{name: "undeclared in condition", template: "{{if .verbose}}Explain.{{end}}", wantErr: true},
+		{name: "range body", template: "{{range .diff}}{{.Line}}{{end}}"},
+		{name: "root from range body", template: "{{range .diff}}{{$.patch}}{{end}}", wantErr: true},
+		{name: "undeclared in else", template: "{{with .diff}}{{.}}{{else}}{{.patch}}{{end}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newRegisteredPrompt(Prompt{
+				Name:      "review",
+				Template:  tt.template,
+				Arguments: []PromptArgument{{Name: "diff"}},
+				Variables: map[string]interface{}{"language": "Go"},
+			}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newRegisteredPrompt() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
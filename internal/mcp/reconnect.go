@@ -0,0 +1,300 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ConnectionState describes the client's connection to its server
+type ConnectionState int
+
+const (
+	// StateConnected means the transport is open and usable
+	StateConnected ConnectionState = iota
+	// StateReconnecting means the transport was lost and the client is
+	// dialing the server again
+	StateReconnecting
+	// StateDisconnected means the transport was lost and will not be
+	// re-established, either because reconnection is disabled or because
+	// every attempt failed
+	StateDisconnected
+	// StateClosed means Close was called
+	StateClosed
+)
+
+// String returns the name of the state
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateDisconnected:
+		return "disconnected"
+	case StateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("ConnectionState(%d)", int(s))
+	}
+}
+
+// StateFunc receives connection state changes. Err is the cause of the
+// change for StateReconnecting and StateDisconnected and nil otherwise.
+type StateFunc func(state ConnectionState, err error)
+
+// ErrClientClosed is returned for calls made after Close
+var ErrClientClosed = errors.New("client closed")
+
+// DisconnectError is returned for requests that fail because the connection
+// to the server was lost. Requests in flight when the connection drops are
+// not retried, since the server may already have acted on them.
+type DisconnectError struct {
+	Err error
+}
+
+// Error implements the error interface
+func (e *DisconnectError) Error() string {
+	return fmt.Sprintf("connection lost: %v", e.Err)
+}
+
+// Unwrap returns the error that ended the connection
+func (e *DisconnectError) Unwrap() error {
+	return e.Err
+}
+
+// ReconnectConfig controls how a client re-establishes a lost connection
+type ReconnectConfig struct {
+	MaxRetries  int           `json:"max_retries"` // 0 retries forever
+	InitialWait time.Duration `json:"initial_wait"`
+	MaxWait     time.Duration `json:"max_wait"`
+	Multiplier  float64       `json:"multiplier"`
+}
+
+// DefaultReconnectConfig returns the reconnection settings used by NewClient
+// and NewStdioClient
+func DefaultReconnectConfig() *ReconnectConfig {
+	return &ReconnectConfig{
+		MaxRetries:  0,
+		InitialWait: 500 * time.Millisecond,
+		MaxWait:     30 * time.Second,
+		Multiplier:  2.0,
+	}
+}
+
+// backoff returns how long to wait before the given attempt, counting from 0
+func (r *ReconnectConfig) backoff(attempt int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	wait := float64(r.InitialWait) * math.Pow(multiplier, float64(attempt))
+	if r.MaxWait > 0 && wait > float64(r.MaxWait) {
+		return r.MaxWait
+	}
+	return time.Duration(wait)
+}
+
+// reconnectInitializeTimeout bounds the initialize handshake after a reconnect
+const reconnectInitializeTimeout = 30 * time.Second
+
+// connection is one transport opened by the client. Lost is closed, with
+// err set, once the transport can no longer be read.
+type connection struct {
+	Transport
+	lost chan struct{}
+	err  error
+}
+
+func newConnection(t Transport) *connection {
+	return &connection{Transport: t, lost: make(chan struct{})}
+}
+
+// OnStateChange registers a callback for connection state changes. It is
+// called from the goroutine that observed the change, never while the
+// client holds its lock.
+func (c *Client) OnStateChange(fn StateFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onStateChange = fn
+}
+
+// State returns the current state of the connection to the server
+func (c *Client) State() ConnectionState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state
+}
+
+// setState records a state change and reports it to the registered
+// callback. A closed client stays closed.
+func (c *Client) setState(state ConnectionState, err error) {
+	c.mu.Lock()
+	if c.state == StateClosed {
+		c.mu.Unlock()
+		return
+	}
+	c.state = state
+	c.lastErr = err
+	fn := c.onStateChange
+	c.mu.Unlock()
+
+	if fn != nil {
+		fn(state, err)
+	}
+}
+
+// connectionError returns the error for calls made while the client is not
+// connected, or nil if it is
+func (c *Client) connectionError() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	switch c.state {
+	case StateConnected:
+		return nil
+	case StateClosed:
+		return ErrClientClosed
+	default:
+		return &DisconnectError{Err: c.lastErr}
+	}
+}
+
+// disconnected fails the requests pending on conn and, if conn is the
+// client's current connection, starts reconnecting
+func (c *Client) disconnected(conn *connection, err error) {
+	c.mu.RLock()
+	current := c.conn == conn && c.state == StateConnected
+	closed := c.state == StateClosed
+	reconnect := c.dialer != nil && c.reconnect != nil
+	c.mu.RUnlock()
+
+	if closed {
+		err = ErrClientClosed
+	}
+	conn.err = &DisconnectError{Err: err}
+	close(conn.lost)
+
+	if !current {
+		return
+	}
+	if !reconnect {
+		c.setState(StateDisconnected, err)
+		return
+	}
+
+	c.setState(StateReconnecting, err)
+	c.reconnectLoop()
+}
+
+// reconnectLoop dials the server with exponential backoff until a connection
+// is re-established, the retries run out, or the client is closed
+func (c *Client) reconnectLoop() {
+	c.mu.RLock()
+	config := *c.reconnect
+	c.mu.RUnlock()
+
+	var err error
+	for attempt := 0; config.MaxRetries == 0 || attempt < config.MaxRetries; attempt++ {
+		select {
+		case <-time.After(config.backoff(attempt)):
+		case <-c.closed:
+			return
+		}
+
+		if err = c.redial(); err == nil {
+			return
+		}
+	}
+
+	c.mu.RLock()
+	reconnecting := c.state == StateReconnecting
+	c.mu.RUnlock()
+	if reconnecting {
+		c.setState(StateDisconnected, fmt.Errorf("reconnect failed after %d attempts: %w", config.MaxRetries, err))
+	}
+}
+
+// redial opens a new transport and, if the client had been initialized,
+// repeats the initialize handshake on it. Registered handlers and callbacks
+// belong to the client rather than the transport, so they carry over.
+func (c *Client) redial() error {
+	t, err := c.dialer()
+	if err != nil {
+		return err
+	}
+	conn := newConnection(t)
+
+	c.mu.Lock()
+	if c.state == StateClosed {
+		c.mu.Unlock()
+		t.Close()
+		return nil
+	}
+	c.conn = conn
+	initialized := c.server != nil
+	rootURI := c.rootURI
+
+	// The new session may expose a different set of tools
+	c.toolsGen++
+	c.toolsValid = false
+	c.tools = nil
+	c.mu.Unlock()
+
+	go c.handleMessages(conn)
+
+	if initialized {
+		ctx, cancel := context.WithTimeout(context.Background(), reconnectInitializeTimeout)
+		defer cancel()
+		if _, err := c.Initialize(ctx, rootURI); err != nil {
+			conn.Close()
+			return fmt.Errorf("error re-initializing: %w", err)
+		}
+		if err := c.resubscribe(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		if err := c.restoreLogLevel(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	select {
+	case <-conn.lost:
+		c.mu.Unlock()
+		return conn.err
+	default:
+	}
+	if c.state != StateReconnecting {
+		c.mu.Unlock()
+		return nil
+	}
+	c.mu.Unlock()
+
+	c.setState(StateConnected, nil)
+	return nil
+}
@@ -0,0 +1,577 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResourceProvider serves a set of resources
+type ResourceProvider interface {
+	// List returns the resources the provider currently serves
+	List(ctx context.Context) ([]Resource, error)
+	// Read returns the contents of the resource at uri, or an error matching
+	// ErrResourceNotFound if the provider does not serve it
+	Read(ctx context.Context, uri string) (*ResourceContents, error)
+}
+
+// WritableResourceProvider is a ResourceProvider whose resources can be
+// overwritten with resources/write
+type WritableResourceProvider interface {
+	ResourceProvider
+	// Write replaces the contents of the resource at contents.URI, returning
+	// an error matching ErrResourceNotFound if the provider does not serve it
+	Write(ctx context.Context, contents ResourceContents) error
+}
+
+// ResourceFunc produces the contents of a resource matching a template.
+// Params holds the values of the template's variables.
+type ResourceFunc func(ctx context.Context, uri string, params map[string]string) (*ResourceContents, error)
+
+// registeredProvider is a provider with the resource type it was registered as
+type registeredProvider struct {
+	resourceType string
+	provider     ResourceProvider
+	// stop ends the provider's watch, if it has one
+	stop context.CancelFunc
+}
+
+// registeredTemplate is a resource template compiled for matching
+type registeredTemplate struct {
+	ResourceTemplate
+	pattern *regexp.Regexp
+	vars    []string
+	fn      ResourceFunc
+}
+
+// templateVar matches an RFC 6570 simple ({name}) or reserved ({+name})
+// expression
+var templateVar = regexp.MustCompile(`\{(\+?)([A-Za-z0-9_.]+)\}`)
+
+// compileTemplate converts a URI template into a regular expression. Simple
+// expressions match a single path segment and reserved expressions match
+// the rest of the URI, slashes included.
+func compileTemplate(template string) (*regexp.Regexp, []string, error) {
+	var pattern strings.Builder
+	var vars []string
+	pattern.WriteString("^")
+
+	last := 0
+	for _, m := range templateVar.FindAllStringSubmatchIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:m[0]]))
+		if m[3] > m[2] {
+			pattern.WriteString("(.+)")
+		} else {
+			pattern.WriteString("([^/?#]+)")
+		}
+		vars = append(vars, template[m[4]:m[5]])
+		last = m[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]))
+	pattern.WriteString("$")
+
+	if len(vars) == 0 {
+		return nil, nil, fmt.Errorf("uri template %q has no variables", template)
+	}
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid uri template %q: %w", template, err)
+	}
+	return re, vars, nil
+}
+
+// match returns the template variables extracted from uri, if it matches
+func (t *registeredTemplate) match(uri string) (map[string]string, bool) {
+	m := t.pattern.FindStringSubmatch(uri)
+	if m == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(t.vars))
+	for i, name := range t.vars {
+		value, err := url.PathUnescape(m[i+1])
+		if err != nil {
+			value = m[i+1]
+		}
+		params[name] = value
+	}
+	return params, true
+}
+
+// RegisterResourceProvider serves the resources of provider. Resources it
+// lists without a type are reported with resourceType, which is also
+// advertised to clients during initialization. Providers that implement
+// ResourceWatcher are watched for changes until the server shuts down.
+func (s *Server) RegisterResourceProvider(resourceType string, provider ResourceProvider) error {
+	if provider == nil {
+		return fmt.Errorf("resource provider for %s is nil", resourceType)
+	}
+
+	ctx, stop := context.WithCancel(s.watchCtx)
+	s.mu.Lock()
+	s.providers = append(s.providers, registeredProvider{resourceType: resourceType, provider: provider, stop: stop})
+	s.mu.Unlock()
+
+	if watcher, ok := provider.(ResourceWatcher); ok {
+		s.watch(ctx, resourceType, watcher)
+	}
+
+	s.notifyListChanged(ResourcesListChanged)
+	return nil
+}
+
+// UnregisterResourceProvider removes the providers registered as
+// resourceType and stops their watches
+func (s *Server) UnregisterResourceProvider(resourceType string) error {
+	s.mu.Lock()
+	var removed []registeredProvider
+	s.providers = slices.DeleteFunc(s.providers, func(p registeredProvider) bool {
+		if p.resourceType == resourceType {
+			removed = append(removed, p)
+			return true
+		}
+		return false
+	})
+	s.mu.Unlock()
+
+	if len(removed) == 0 {
+		return fmt.Errorf("no resource provider registered as %s", resourceType)
+	}
+	for _, p := range removed {
+		p.stop()
+	}
+
+	s.notifyListChanged(ResourcesListChanged)
+	return nil
+}
+
+// RegisterResourceTemplate serves resources whose URIs match template by
+// calling fn. Templates are consulted after registered resources and
+// providers, in the order they were registered.
+func (s *Server) RegisterResourceTemplate(template ResourceTemplate, fn ResourceFunc) error {
+	if fn == nil {
+		return fmt.Errorf("resource template %s has no handler", template.URITemplate)
+	}
+	pattern, vars, err := compileTemplate(template.URITemplate)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.templates {
+		if existing.URITemplate == template.URITemplate {
+			return fmt.Errorf("resource template %s already registered", template.URITemplate)
+		}
+	}
+	s.templates = append(s.templates, &registeredTemplate{
+		ResourceTemplate: template,
+		pattern:          pattern,
+		vars:             vars,
+		fn:               fn,
+	})
+	return nil
+}
+
+// resourceProviders returns the registered resources followed by the
+// registered providers
+func (s *Server) resourceProviders() []registeredProvider {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]registeredProvider{{provider: s.static}}, s.providers...)
+}
+
+// listResources returns the resources of every provider
+func (s *Server) listResources(ctx context.Context) ([]Resource, error) {
+	var resources []Resource
+	for _, p := range s.resourceProviders() {
+		listed, err := p.provider.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s resources: %w", p.resourceType, err)
+		}
+		for _, resource := range listed {
+			if resource.Type == "" {
+				resource.Type = p.resourceType
+			}
+			resources = append(resources, resource)
+		}
+	}
+	return resources, nil
+}
+
+// readResource returns the contents of the resource at uri from the first
+// provider or template that serves it
+func (s *Server) readResource(ctx context.Context, uri string) (*ResourceContents, error) {
+	for _, p := range s.resourceProviders() {
+		contents, err := p.provider.Read(ctx, uri)
+		if errors.Is(err, ErrResourceNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return contents, nil
+	}
+
+	s.mu.RLock()
+	templates := s.templates
+	s.mu.RUnlock()
+	for _, t := range templates {
+		if params, ok := t.match(uri); ok {
+			contents, err := t.fn(ctx, uri, params)
+			if err != nil {
+				return nil, err
+			}
+			if contents.URI == "" {
+				contents.URI = uri
+			}
+			if contents.MimeType == "" {
+				contents.MimeType = t.MimeType
+			}
+			return contents, nil
+		}
+	}
+
+	return nil, errorf(CodeResourceNotFound, map[string]interface{}{"uri": uri}, "resource %s not found", uri)
+}
+
+// writeResource writes contents to the first writable provider that serves
+// its URI
+func (s *Server) writeResource(ctx context.Context, contents ResourceContents) error {
+	for _, p := range s.resourceProviders() {
+		writable, ok := p.provider.(WritableResourceProvider)
+		if !ok {
+			continue
+		}
+		err := writable.Write(ctx, contents)
+		if errors.Is(err, ErrResourceNotFound) {
+			continue
+		}
+		return err
+	}
+
+	return errorf(CodeResourceNotFound, map[string]interface{}{"uri": contents.URI}, "resource %s not found", contents.URI)
+}
+
+// MemoryProvider serves resources held in memory. It is safe for
+// concurrent use.
+type MemoryProvider struct {
+	mu        sync.RWMutex
+	resources map[string]memoryResource
+	watchers  []*memoryWatcher
+}
+
+type memoryResource struct {
+	Resource
+	contents ResourceContents
+}
+
+// NewMemoryProvider creates an empty in-memory resource provider
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{resources: make(map[string]memoryResource)}
+}
+
+// Set adds or replaces a resource and its contents
+func (p *MemoryProvider) Set(resource Resource, contents ResourceContents) {
+	contents.URI = resource.URI
+	if contents.MimeType == "" {
+		contents.MimeType = resource.MimeType
+	}
+
+	p.mu.Lock()
+	_, existed := p.resources[resource.URI]
+	p.resources[resource.URI] = memoryResource{Resource: resource, contents: contents}
+	p.mu.Unlock()
+
+	p.notify(resource.URI, !existed)
+}
+
+// add adds a resource with empty contents unless one with its URI exists
+func (p *MemoryProvider) add(resource Resource) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.resources[resource.URI]; exists {
+		return false
+	}
+	p.resources[resource.URI] = memoryResource{
+		Resource: resource,
+		contents: ResourceContents{URI: resource.URI, MimeType: resource.MimeType},
+	}
+	return true
+}
+
+// replace replaces a resource's descriptor, keeping its contents
+func (p *MemoryProvider) replace(resource Resource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	contents := p.resources[resource.URI].contents
+	contents.URI = resource.URI
+	p.resources[resource.URI] = memoryResource{Resource: resource, contents: contents}
+}
+
+// Delete removes a resource, reporting whether it existed
+func (p *MemoryProvider) Delete(uri string) bool {
+	p.mu.Lock()
+	_, exists := p.resources[uri]
+	delete(p.resources, uri)
+	p.mu.Unlock()
+
+	if exists {
+		p.notify(uri, true)
+	}
+	return exists
+}
+
+// types returns the type of each resource held by the provider
+func (p *MemoryProvider) types() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var types []string
+	for _, resource := range p.resources {
+		types = append(types, resource.Type)
+	}
+	return types
+}
+
+// List implements ResourceProvider. Resources are sorted by URI.
+func (p *MemoryProvider) List(ctx context.Context) ([]Resource, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	resources := make([]Resource, 0, len(p.resources))
+	for _, resource := range p.resources {
+		resources = append(resources, resource.Resource)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].URI < resources[j].URI })
+	return resources, nil
+}
+
+// Read implements ResourceProvider
+func (p *MemoryProvider) Read(ctx context.Context, uri string) (*ResourceContents, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	resource, ok := p.resources[uri]
+	if !ok {
+		return nil, ErrResourceNotFound
+	}
+	contents := resource.contents
+	return &contents, nil
+}
+
+// Write implements WritableResourceProvider. The MIME type is kept if the
+// new contents do not carry one.
+func (p *MemoryProvider) Write(ctx context.Context, contents ResourceContents) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	resource, ok := p.resources[contents.URI]
+	if !ok {
+		return ErrResourceNotFound
+	}
+	if contents.MimeType == "" {
+		contents.MimeType = resource.contents.MimeType
+	}
+	resource.contents = contents
+	p.resources[contents.URI] = resource
+	return nil
+}
+
+// maxFileResourceSize bounds the size of files served by FileProvider
+const maxFileResourceSize = 10 << 20
+
+// FileProvider serves the regular files under a directory as file://
+// resources. It is read-only unless WithWrites is called.
+type FileProvider struct {
+	root         string
+	writable     bool
+	pollInterval time.Duration
+
+	// snapshot is the file state last reported by Watch
+	mu       sync.Mutex
+	snapshot map[string]fileState
+
+	// afterScan, if set, is called after each scan Watch makes, letting
+	// tests synchronize with it
+	afterScan func()
+}
+
+// NewFileProvider creates a provider for the files under root
+func NewFileProvider(root string) (*FileProvider, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", root, err)
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving %s: %w", root, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+
+	return &FileProvider{root: abs}, nil
+}
+
+// WithWrites allows resources/write to overwrite existing files
+func (p *FileProvider) WithWrites() *FileProvider {
+	p.writable = true
+	return p
+}
+
+// fileURI returns the resource URI for an absolute path
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// resolve maps a file:// URI to a path under the provider's root
+func (p *FileProvider) resolve(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || (u.Host != "" && u.Host != "localhost") {
+		return "", ErrResourceNotFound
+	}
+
+	path, err := filepath.EvalSymlinks(filepath.FromSlash(u.Path))
+	if err != nil {
+		return "", ErrResourceNotFound
+	}
+	rel, err := filepath.Rel(p.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrResourceNotFound
+	}
+	return path, nil
+}
+
+// List implements ResourceProvider
+func (p *FileProvider) List(ctx context.Context) ([]Resource, error) {
+	var resources []Resource
+	err := filepath.WalkDir(p.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(p.root, path)
+		resources = append(resources, Resource{
+			URI:      fileURI(path),
+			Type:     "file",
+			Name:     filepath.ToSlash(rel),
+			MimeType: mime.TypeByExtension(filepath.Ext(path)),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// Read implements ResourceProvider. Text files are returned as Text and
+// anything else as Blob.
+func (p *FileProvider) Read(ctx context.Context, uri string) (*ResourceContents, error) {
+	path, err := p.resolve(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, ErrResourceNotFound
+	}
+	if info.Size() > maxFileResourceSize {
+		return nil, errorf(CodeInvalidRequest, map[string]interface{}{"uri": uri}, "resource %s exceeds %d bytes", uri, maxFileResourceSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", uri, err)
+	}
+
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	contents := &ResourceContents{URI: uri, MimeType: mimeType}
+	if isTextMIME(mimeType) {
+		contents.Text = string(data)
+	} else {
+		contents.Blob = data
+	}
+	return contents, nil
+}
+
+// Write implements WritableResourceProvider
+func (p *FileProvider) Write(ctx context.Context, contents ResourceContents) error {
+	path, err := p.resolve(contents.URI)
+	if err != nil {
+		return err
+	}
+	if !p.writable {
+		return errorf(CodeForbidden, map[string]interface{}{"uri": contents.URI}, "resource %s is read-only", contents.URI)
+	}
+
+	data := contents.Blob
+	if data == nil {
+		data = []byte(contents.Text)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %w", contents.URI, err)
+	}
+	p.recordWrite(path)
+	return nil
+}
+
+// isTextMIME reports whether content of the given MIME type is text
+func isTextMIME(mimeType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, suffix := range []string{"json", "xml", "yaml", "javascript"} {
+		if strings.HasSuffix(mediaType, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResourceProviders(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := NewFileProvider(dir)
+	if err != nil {
+		t.Fatalf("NewFileProvider() error = %v", err)
+	}
+
+	memory := NewMemoryProvider()
+	memory.Set(Resource{URI: "memory://config"}, ResourceContents{MimeType: "application/json", Text: `{"debug":true}`})
+
+	s := NewServer()
+	if err := s.RegisterResourceProvider("file", files); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterResourceProvider("memory", memory); err != nil {
+		t.Fatal(err)
+	}
+	err = s.RegisterResourceTemplate(ResourceTemplate{URITemplate: "users://{id}/profile", MimeType: "text/plain"},
+		func(ctx context.Context, uri string, params map[string]string) (*ResourceContents, error) {
+			return &ResourceContents{Text: "user " + params["id"]}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notesURI := fileURI(filepath.Join(files.root, "notes.txt"))
+	outsideURI := fileURI(filepath.Join(filepath.Dir(files.root), "secret.txt"))
+
+	tests := []struct {
+		name     string
+		uri      string
+		wantText string
+		wantMIME string
+		wantErr  error
+	}{
+		{name: "file", uri: notesURI, wantText: "hello", wantMIME: "text/plain; charset=utf-8"},
+		{name: "memory", uri: "memory://config", wantText: `{"debug":true}`, wantMIME: "application/json"},
+		{name: "template", uri: "users://42/profile", wantText: "user 42", wantMIME: "text/plain"},
+		{name: "outside file root", uri: outsideURI, wantErr: ErrResourceNotFound},
+		{name: "unknown", uri: "memory://missing", wantErr: ErrResourceNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents, err := s.readResource(context.Background(), tt.uri)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("readResource() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readResource() error = %v", err)
+			}
+			if contents.Text != tt.wantText || contents.MimeType != tt.wantMIME {
+				t.Errorf("readResource() = %q (%s), want %q (%s)", contents.Text, contents.MimeType, tt.wantText, tt.wantMIME)
+			}
+		})
+	}
+}
+
+func TestResourcesReadWrite(t *testing.T) {
+	s := NewServer()
+	if err := s.RegisterResource(Resource{URI: "memory://scratch", Type: "memory"}); err != nil {
+		t.Fatal(err)
+	}
+	client := connect(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	params, _ := json.Marshal(ResourceContents{URI: "memory://scratch", MimeType: "text/plain", Text: "draft"})
+	if _, err := client.sendRequest(ctx, ResourcesWrite, params); err != nil {
+		t.Fatalf("resources/write error = %v", err)
+	}
+
+	params, _ = json.Marshal(map[string]string{"uri": "memory://scratch"})
+	response, err := client.sendRequest(ctx, ResourcesRead, params)
+	if err != nil {
+		t.Fatalf("resources/read error = %v", err)
+	}
+	var result struct {
+		Contents []ResourceContents `json:"contents"`
+	}
+	if err := json.Unmarshal(response.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Contents) != 1 || result.Contents[0].Text != "draft" {
+		t.Errorf("resources/read = %+v, want the written text", result.Contents)
+	}
+}
+
+func TestResourceSubscriptions(t *testing.T) {
+	// Resolved so the path matches the URIs the provider reports
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "watched.txt")
+	if err := os.WriteFile(path, []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := NewFileProvider(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanned := make(chan struct{}, 1)
+	files.afterScan = func() {
+		select {
+		case scanned <- struct{}{}:
+		default:
+		}
+	}
+
+	s := NewServer()
+	if err := s.RegisterResource(Resource{URI: "memory://scratch", Type: "memory"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterResourceProvider("file", files.WithPollInterval(10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+	client := connect(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	updates := make(chan string, 4)
+	onUpdate := func(uri string) { updates <- uri }
+	watched := fileURI(path)
+	for _, uri := range []string{"memory://scratch", watched} {
+		if err := client.Subscribe(ctx, uri, onUpdate); err != nil {
+			t.Fatalf("Subscribe(%s) error = %v", uri, err)
+		}
+	}
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case uri := <-updates:
+			if uri != want {
+				t.Errorf("updated %s, want %s", uri, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("no update for %s", want)
+		}
+	}
+
+	params, _ := json.Marshal(ResourceContents{URI: "memory://scratch", Text: "draft"})
+	if _, err := client.sendRequest(ctx, ResourcesWrite, params); err != nil {
+		t.Fatalf("resources/write error = %v", err)
+	}
+	expect("memory://scratch")
+
+	// Change the file only once the watcher has taken its first snapshot
+	<-scanned
+	if err := os.WriteFile(path, []byte("version two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expect(watched)
+
+	if err := client.Unsubscribe(ctx, "memory://scratch"); err != nil {
+		t.Fatalf("Unsubscribe() error = %v", err)
+	}
+	if _, err := client.sendRequest(ctx, ResourcesWrite, params); err != nil {
+		t.Fatalf("resources/write error = %v", err)
+	}
+	timeout := time.After(50 * time.Millisecond)
+	for {
+		select {
+		case uri := <-updates:
+			// The file is still subscribed to
+			if uri == "memory://scratch" {
+				t.Errorf("updated %s after unsubscribing", uri)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+)
+
+// SamplingMessage is one message of the conversation a server asks the
+// client's model to continue
+type SamplingMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// CreateMessageParams represents parameters for a sampling/createMessage
+// request. MaxTokens is an upper bound; the client may lower it. A nil
+// Temperature leaves the choice to the client.
+type CreateMessageParams struct {
+	Messages      []SamplingMessage `json:"messages"`
+	SystemPrompt  string            `json:"systemPrompt,omitempty"`
+	MaxTokens     int               `json:"maxTokens"`
+	Temperature   *float32          `json:"temperature,omitempty"`
+	StopSequences []string          `json:"stopSequences,omitempty"`
+}
+
+// CreateMessageResult is the completion returned for a sampling request
+type CreateMessageResult struct {
+	Role       string `json:"role"`
+	Content    string `json:"content"`
+	Model      string `json:"model"`
+	StopReason string `json:"stopReason,omitempty"`
+}
+
+// SamplingHandler answers sampling requests from the server. Returning
+// ErrRequestDeclined, or an MCPError with its code, tells the server the
+// host refused.
+type SamplingHandler func(ctx context.Context, params CreateMessageParams) (*CreateMessageResult, error)
+
+// WithSampling answers the server's sampling requests with handler and
+// advertises sampling support. It must be called before Initialize.
+func (c *Client) WithSampling(handler SamplingHandler) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capabilities.Sampling.Supported = true
+	c.handlers[SamplingCreateMessage] = func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+		var params CreateMessageParams
+		if err := sonic.Unmarshal(msg.Params, &params); err != nil {
+			return nil, NewError(CodeInvalidParams, "invalid sampling params", err.Error())
+		}
+
+		result, err := handler(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := sonic.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling sampling result: %w", err)
+		}
+		return &MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: data}, nil
+	}
+	return c
+}
+
+// CreateMessage asks a client to sample a completion from its model
+func (s *Server) CreateMessage(ctx context.Context, client *ClientState, params CreateMessageParams) (*CreateMessageResult, error) {
+	s.mu.RLock()
+	supported := client.Capabilities.Sampling.Supported
+	s.mu.RUnlock()
+	if !supported {
+		return nil, fmt.Errorf("%w: %s", ErrCapabilityNotSupported, SamplingCreateMessage)
+	}
+
+	response, err := s.Request(ctx, client, SamplingCreateMessage, params)
+	if err != nil {
+		return nil, fmt.Errorf("sampling/createMessage request failed: %w", err)
+	}
+
+	var result CreateMessageResult
+	if err := sonic.Unmarshal(response.Result, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling sampling result: %w", err)
+	}
+	return &result, nil
+}
+
+// samplerKey is the context key for a request's Sampler
+type samplerKey struct{}
+
+// Sampler sends sampling requests to the client a request came from
+type Sampler struct {
+	server *Server
+	client *ClientState
+}
+
+// SamplerFromContext returns the sampler for the client whose request is
+// being handled under ctx. It never returns nil; outside a request, its
+// CreateMessage fails with ErrCapabilityNotSupported.
+func SamplerFromContext(ctx context.Context) *Sampler {
+	if sampler, ok := ctx.Value(samplerKey{}).(*Sampler); ok {
+		return sampler
+	}
+	return &Sampler{}
+}
+
+// withSampler attaches a sampler for client to ctx
+func withSampler(ctx context.Context, s *Server, client *ClientState) context.Context {
+	return context.WithValue(ctx, samplerKey{}, &Sampler{server: s, client: client})
+}
+
+// CreateMessage asks the client to sample a completion from its model
+func (sm *Sampler) CreateMessage(ctx context.Context, params CreateMessageParams) (*CreateMessageResult, error) {
+	if sm == nil || sm.client == nil {
+		return nil, fmt.Errorf("%w: %s", ErrCapabilityNotSupported, SamplingCreateMessage)
+	}
+	return sm.server.CreateMessage(ctx, sm.client, params)
+}
@@ -0,0 +1,382 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bytedance/sonic"
+)
+
+// ValidationError describes one way a value fails a schema
+type ValidationError struct {
+	Path    string `json:"path"` // JSON Pointer to the failing value, "" for the root
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Schema is a compiled JSON Schema. It supports the keywords tool
+// definitions use: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum, allOf,
+// anyOf, oneOf and not. Other keywords are ignored.
+type Schema struct {
+	root     map[string]interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// CompileSchema compiles a JSON Schema given as a map, a struct or raw JSON.
+// A nil schema compiles to nil, which accepts every value.
+func CompileSchema(schema interface{}) (*Schema, error) {
+	if schema == nil {
+		return nil, nil
+	}
+
+	raw, ok := schema.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = sonic.Marshal(schema); err != nil {
+			return nil, fmt.Errorf("error marshaling schema: %w", err)
+		}
+	}
+
+	var root map[string]interface{}
+	if err := sonic.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("schema must be a JSON object: %w", err)
+	}
+
+	s := &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.compilePatterns(root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// compilePatterns compiles every pattern keyword in schema up front so
+// validation cannot fail on a bad expression. Only keywords whose values are
+// schemas are walked, so property names and enum data are never mistaken
+// for keywords.
+func (s *Schema) compilePatterns(schema interface{}) error {
+	node, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if pattern, ok := node["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		s.patterns[pattern] = re
+	}
+
+	children := []interface{}{node["items"], node["additionalProperties"], node["not"]}
+	if properties, ok := node["properties"].(map[string]interface{}); ok {
+		for _, child := range properties {
+			children = append(children, child)
+		}
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		if subs, ok := node[keyword].([]interface{}); ok {
+			children = append(children, subs...)
+		}
+	}
+	for _, child := range children {
+		if err := s.compilePatterns(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the JSON document data against the schema and returns
+// every failure found
+func (s *Schema) Validate(data json.RawMessage) []ValidationError {
+	if s == nil {
+		return nil
+	}
+
+	var value interface{}
+	if err := sonic.Unmarshal(data, &value); err != nil {
+		return []ValidationError{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	var errs []ValidationError
+	s.validate(s.root, value, "", &errs)
+	return errs
+}
+
+// ValidateValue checks a Go value against the schema by way of its JSON
+// encoding
+func (s *Schema) ValidateValue(value interface{}) []ValidationError {
+	data, err := sonic.Marshal(value)
+	if err != nil {
+		return []ValidationError{{Message: fmt.Sprintf("error marshaling value: %v", err)}}
+	}
+	return s.Validate(data)
+}
+
+func (s *Schema) validate(schema map[string]interface{}, value interface{}, path string, errs *[]ValidationError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if types, ok := schemaTypes(schema["type"]); ok && !typeAllowed(types, value) {
+		fail("expected %s, got %s", strings.Join(types, " or "), jsonType(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", formatValues(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		fail("must be %s", formatValues([]interface{}{constant}))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		s.validateObject(schema, v, path, errs)
+	case []interface{}:
+		s.validateArray(schema, v, path, errs)
+	case string:
+		length := utf8.RuneCountInString(v)
+		if min, ok := schemaNumber(schema["minLength"]); ok && float64(length) < min {
+			fail("must be at least %v characters", min)
+		}
+		if max, ok := schemaNumber(schema["maxLength"]); ok && float64(length) > max {
+			fail("must be at most %v characters", max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !s.matchPattern(pattern, v) {
+			fail("must match pattern %q", pattern)
+		}
+	case float64:
+		if min, ok := schemaNumber(schema["minimum"]); ok && v < min {
+			fail("must be >= %v", min)
+		}
+		if max, ok := schemaNumber(schema["maximum"]); ok && v > max {
+			fail("must be <= %v", max)
+		}
+		if min, ok := schemaNumber(schema["exclusiveMinimum"]); ok && v <= min {
+			fail("must be > %v", min)
+		}
+		if max, ok := schemaNumber(schema["exclusiveMaximum"]); ok && v >= max {
+			fail("must be < %v", max)
+		}
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			if subSchema, ok := sub.(map[string]interface{}); ok {
+				s.validate(subSchema, value, path, errs)
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && s.countMatches(anyOf, value, path) == 0 {
+		fail("must match at least one schema in anyOf")
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if n := s.countMatches(oneOf, value, path); n != 1 {
+			fail("must match exactly one schema in oneOf, matched %d", n)
+		}
+	}
+	if not, ok := schema["not"].(map[string]interface{}); ok && s.countMatches([]interface{}{not}, value, path) == 1 {
+		fail("must not match the schema in not")
+	}
+}
+
+func (s *Schema) validateObject(schema, object map[string]interface{}, path string, errs *[]ValidationError) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, present := object[name]; !present {
+					*errs = append(*errs, ValidationError{Path: joinPointer(path, name), Message: "is required"})
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	// Visit properties in a stable order so errors are reported consistently
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := joinPointer(path, name)
+		if propSchema, ok := properties[name].(map[string]interface{}); ok {
+			s.validate(propSchema, object[name], child, errs)
+			continue
+		}
+		if _, declared := properties[name]; declared {
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, ValidationError{Path: child, Message: "is not allowed"})
+			}
+		case map[string]interface{}:
+			s.validate(additional, object[name], child, errs)
+		}
+	}
+}
+
+func (s *Schema) validateArray(schema map[string]interface{}, array []interface{}, path string, errs *[]ValidationError) {
+	if min, ok := schemaNumber(schema["minItems"]); ok && float64(len(array)) < min {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("must have at least %v items", min)})
+	}
+	if max, ok := schemaNumber(schema["maxItems"]); ok && float64(len(array)) > max {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf("must have at most %v items", max)})
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range array {
+			s.validate(items, item, joinPointer(path, strconv.Itoa(i)), errs)
+		}
+	}
+}
+
+// matchPattern reports whether v matches pattern, compiling it on the spot
+// if it was not seen when the schema was compiled
+func (s *Schema) matchPattern(pattern, v string) bool {
+	re, ok := s.patterns[pattern]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return false
+		}
+	}
+	return re.MatchString(v)
+}
+
+// countMatches returns how many of schemas value satisfies
+func (s *Schema) countMatches(schemas []interface{}, value interface{}, path string) int {
+	matches := 0
+	for _, sub := range schemas {
+		subSchema, ok := sub.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var subErrs []ValidationError
+		s.validate(subSchema, value, path, &subErrs)
+		if len(subErrs) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+// schemaTypes returns the types allowed by a type keyword
+func schemaTypes(keyword interface{}) ([]string, bool) {
+	switch t := keyword.(type) {
+	case string:
+		return []string{t}, true
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types, len(types) > 0
+	}
+	return nil, false
+}
+
+// typeAllowed reports whether value has one of types. Integers are numbers.
+func typeAllowed(types []string, value interface{}) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type name of a decoded JSON value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func schemaNumber(keyword interface{}) (float64, bool) {
+	n, ok := keyword.(float64)
+	return n, ok
+}
+
+func formatValues(values []interface{}) string {
+	formatted := make([]string, len(values))
+	for i, v := range values {
+		data, _ := sonic.Marshal(v)
+		formatted[i] = string(data)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// joinPointer appends a reference token to a JSON Pointer
+func joinPointer(path, token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	token = strings.ReplaceAll(token, "/", "~1")
+	return path + "/" + token
+}
@@ -0,0 +1,122 @@
+package mcp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := CompileSchema(map[string]interface{}{
+		"type":     "object",
+		"required": []string{"operation", "numbers"},
+		"properties": map[string]interface{}{
+			"operation": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"add", "subtract"},
+			},
+			"numbers": map[string]interface{}{
+				"type":     "array",
+				"minItems": 1,
+				"items":    map[string]interface{}{"type": "number", "minimum": 0},
+			},
+			"label": map[string]interface{}{
+				"type":    "string",
+				"pattern": "^[a-z]+$",
+			},
+		},
+		"additionalProperties": false,
+	})
+	if err != nil {
+		t.Fatalf("CompileSchema() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		data      string
+		wantPaths []string
+	}{
+		{name: "valid", data: `{"operation":"add","numbers":[1,2.5]}`},
+		{name: "missing required", data: `{"operation":"add"}`, wantPaths: []string{"/numbers"}},
+		{name: "wrong type", data: `{"operation":1,"numbers":[1]}`, wantPaths: []string{"/operation"}},
+		{name: "not in enum", data: `{"operation":"divide","numbers":[1]}`, wantPaths: []string{"/operation"}},
+		{name: "bad array item", data: `{"operation":"add","numbers":[1,"two",-3]}`, wantPaths: []string{"/numbers/1", "/numbers/2"}},
+		{name: "too few items", data: `{"operation":"add","numbers":[]}`, wantPaths: []string{"/numbers"}},
+		{name: "pattern", data: `{"operation":"add","numbers":[1],"label":"A1"}`, wantPaths: []string{"/label"}},
+		{name: "additional property", data: `{"operation":"add","numbers":[1],"extra":true}`, wantPaths: []string{"/extra"}},
+		{name: "not an object", data: `[1]`, wantPaths: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, err := range schema.Validate(json.RawMessage(tt.data)) {
+				paths = append(paths, err.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("Validate() failing paths = %q, want %q", paths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestSchemaKeywordPropertyNames(t *testing.T) {
+	schema, err := CompileSchema(json.RawMessage(`{"properties":{
+		"enum":{"type":"string","pattern":"^a"},
+		"const":{"type":"string","pattern":"^b"}
+	}}`))
+	if err != nil {
+		t.Fatalf("CompileSchema() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		data      string
+		wantPaths []string
+	}{
+		{name: "valid", data: `{"enum":"abc","const":"bcd"}`},
+		{name: "mismatch", data: `{"enum":"xyz","const":"xyz"}`, wantPaths: []string{"/const", "/enum"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, err := range schema.Validate(json.RawMessage(tt.data)) {
+				paths = append(paths, err.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("Validate() failing paths = %q, want %q", paths, tt.wantPaths)
+			}
+		})
+	}
+}
+
+func TestSchemaFor(t *testing.T) {
+	type inner struct {
+		Tags []string `json:"tags,omitempty"`
+	}
+	type args struct {
+		inner
+		Query string  `json:"query" description:"Search terms"`
+		Limit *int    `json:"limit"`
+		Sort  string  `json:"sort,omitempty" enum:"asc,desc"`
+		Score float64 `json:"score" required:"false"`
+		skip  string
+	}
+
+	schema := SchemaFor[args]()
+	want := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tags":  map[string]interface{}{"type": []string{"array", "null"}, "items": map[string]interface{}{"type": "string"}},
+			"query": map[string]interface{}{"type": "string", "description": "Search terms"},
+			"limit": map[string]interface{}{"type": []string{"integer", "null"}},
+			"sort":  map[string]interface{}{"type": "string", "enum": []interface{}{"asc", "desc"}},
+			"score": map[string]interface{}{"type": "number"},
+		},
+		"required": []string{"query"},
+	}
+	if !reflect.DeepEqual(schema, want) {
+		t.Errorf("SchemaFor() = %v, want %v", schema, want)
+	}
+}
@@ -22,10 +22,15 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -35,34 +40,150 @@ import (
 // Server represents an MCP server
 type Server struct {
 	capabilities ServerCapabilities
-	tools        map[string]Tool
-	resources    map[string]Resource
-	prompts      map[string]Prompt
+	tools        map[string]registeredTool
+	static       *MemoryProvider
+	providers    []registeredProvider
+	templates    []*registeredTemplate
+	prompts      map[string]registeredPrompt
 	handlers     map[MCPMethod]HandlerFunc
-	clients      map[*websocket.Conn]*ClientState
+	middleware   []Middleware
+	clients      map[Transport]*ClientState
+	sessions     map[string]*sseSession
 	mu           sync.RWMutex
+
+	// Request dispatch limits
+	timeout        time.Duration
+	methodTimeouts map[MCPMethod]time.Duration
+	sem            chan struct{}
+
+	// info identifies the server to clients during initialization
+	info Implementation
+
+	// Access control
+	authenticator Authenticator
+	policy        Policy
+
+	// validateResults checks tool output against the tool's Returns schema
+	validateResults bool
+
+	// pageSize is the maximum number of items in a list response
+	pageSize int
+
+	// nextID numbers server-initiated requests
+	nextID atomic.Int64
+
+	// logger receives the server's own log records
+	logger atomic.Pointer[slog.Logger]
+
+	// inflight tracks running handlers so Shutdown can drain them
+	inflight sync.WaitGroup
+	closing  bool
+
+	// watchCtx bounds resource provider watches, which end at Shutdown
+	watchCtx  context.Context
+	stopWatch context.CancelFunc
 }
 
+// DefaultRequestTimeout is the time a request handler may run unless
+// overridden with WithTimeout or WithMethodTimeout
+const DefaultRequestTimeout = 30 * time.Second
+
 // ClientState represents the state of a connected client
 type ClientState struct {
-	Capabilities ClientCapabilities
-	RootURI      string
-	Initialized  bool
+	Capabilities    ClientCapabilities
+	RootURI         string
+	ProtocolVersion string
+	ClientInfo      Implementation
+	Initialized     bool
+	// Principal is the authenticated identity of the client, or nil if the
+	// server has no authenticator
+	Principal *Principal
+
+	conn Transport
+	// requests holds cancel functions for in-flight requests by ID
+	requests map[string]context.CancelCauseFunc
+	// pending holds response channels for server-initiated requests by ID
+	pending map[string]chan *MCPMessage
+	// subscriptions holds the resource URIs the client subscribed to
+	subscriptions map[string]bool
+	// logLevel is the minimum level of log records sent to the client, or
+	// nil if it has not asked for any
+	logLevel *slog.Level
+	// done is closed when the connection ends
+	done chan struct{}
 }
 
+// errRequestCancelled is the cancellation cause for requests the client
+// cancelled with $/cancelRequest
+var errRequestCancelled = errors.New("request cancelled by client")
+
 // HandlerFunc represents a function that handles MCP messages
 type HandlerFunc func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error)
 
+// ToolHandler executes a tool call. It receives the raw arguments from
+// ToolCallParams and returns a value that is marshaled as the call result.
+type ToolHandler func(ctx context.Context, arguments json.RawMessage) (interface{}, error)
+
+// registeredTool pairs a tool definition with the handler that executes it
+// and its compiled parameter and return schemas
+type registeredTool struct {
+	Tool
+	handler ToolHandler
+	params  *Schema
+	returns *Schema
+}
+
+// newRegisteredTool validates a tool definition and compiles its schemas
+func newRegisteredTool(tool Tool, handler ToolHandler) (registeredTool, error) {
+	if handler == nil {
+		return registeredTool{}, fmt.Errorf("tool %s has no handler", tool.Name)
+	}
+
+	params, err := CompileSchema(tool.Parameters)
+	if err != nil {
+		return registeredTool{}, fmt.Errorf("tool %s has invalid parameters schema: %w", tool.Name, err)
+	}
+	returns, err := CompileSchema(tool.Returns)
+	if err != nil {
+		return registeredTool{}, fmt.Errorf("tool %s has invalid returns schema: %w", tool.Name, err)
+	}
+
+	return registeredTool{Tool: tool, handler: handler, params: params, returns: returns}, nil
+}
+
+// TypedToolHandler adapts a function taking decoded arguments into a ToolHandler
+func TypedToolHandler[T any](fn func(ctx context.Context, args T) (interface{}, error)) ToolHandler {
+	return func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		var args T
+		if len(arguments) > 0 && string(arguments) != "null" {
+			if err := sonic.Unmarshal(arguments, &args); err != nil {
+				return nil, NewError(CodeInvalidParams, "invalid tool arguments", err.Error())
+			}
+		}
+		return fn(ctx, args)
+	}
+}
+
 // NewServer creates a new MCP server
 func NewServer() *Server {
 	s := &Server{
-		tools:     make(map[string]Tool),
-		resources: make(map[string]Resource),
-		prompts:   make(map[string]Prompt),
-		handlers:  make(map[MCPMethod]HandlerFunc),
-		clients:   make(map[*websocket.Conn]*ClientState),
+		tools:    make(map[string]registeredTool),
+		static:   NewMemoryProvider(),
+		prompts:  make(map[string]registeredPrompt),
+		handlers: make(map[MCPMethod]HandlerFunc),
+		clients:  make(map[Transport]*ClientState),
+		sessions: make(map[string]*sseSession),
+
+		info:           Implementation{Name: "nexus"},
+		policy:         allowAll{},
+		pageSize:       DefaultPageSize,
+		timeout:        DefaultRequestTimeout,
+		methodTimeouts: make(map[MCPMethod]time.Duration),
 	}
 
+	s.watchCtx, s.stopWatch = context.WithCancel(context.Background())
+	s.logger.Store(slog.Default())
+
 	// Register default handlers
 	s.handlers[Initialize] = s.handleInitialize
 	s.handlers[Initialized] = s.handleInitialized
@@ -71,155 +192,659 @@ func NewServer() *Server {
 	s.handlers[ResourcesList] = s.handleResourcesList
 	s.handlers[ResourcesRead] = s.handleResourcesRead
 	s.handlers[ResourcesWrite] = s.handleResourcesWrite
+	s.handlers[ResourcesTemplatesList] = s.handleResourcesTemplatesList
+	s.handlers[ResourcesSubscribe] = s.handleResourcesSubscribe
+	s.handlers[ResourcesUnsubscribe] = s.handleResourcesUnsubscribe
 	s.handlers[PromptsList] = s.handlePromptsList
 	s.handlers[PromptsRender] = s.handlePromptsRender
+	s.handlers[CancelRequest] = s.handleCancelRequest
+	s.handlers[Ping] = handlePing
+	s.handlers[LoggingSetLevel] = s.handleLoggingSetLevel
+
+	return s
+}
+
+// WithInfo sets the name and version the server reports to clients
+func (s *Server) WithInfo(name, version string) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.info = Implementation{Name: name, Version: version}
+	return s
+}
+
+// WithCapabilities declares capabilities the server advertises in addition
+// to those derived from what is registered, such as tool support for a
+// server that registers its tools only after clients connect
+func (s *Server) WithCapabilities(capabilities ServerCapabilities) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capabilities = capabilities
+	return s
+}
+
+// WithAuthenticator requires clients to authenticate. Credentials are
+// checked when an HTTP connection is opened, or during initialize for
+// connections opened without any; unauthenticated clients cannot initialize.
+func (s *Server) WithAuthenticator(authenticator Authenticator) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authenticator = authenticator
+	return s
+}
+
+// WithPolicy restricts which tools, resources and prompts each principal
+// may list and invoke. By default everything is allowed.
+func (s *Server) WithPolicy(policy Policy) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if policy == nil {
+		policy = allowAll{}
+	}
+	s.policy = policy
+	return s
+}
+
+// WithResultValidation makes the server check each tool's output against the
+// tool's Returns schema. Output that does not match is reported to the
+// client as an internal error instead of being returned.
+func (s *Server) WithResultValidation(enabled bool) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validateResults = enabled
+	return s
+}
+
+// WithTimeout sets the default time a request handler may run
+func (s *Server) WithTimeout(timeout time.Duration) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeout = timeout
+	return s
+}
 
+// WithMethodTimeout sets the time a handler for method may run, overriding
+// the default timeout
+func (s *Server) WithMethodTimeout(method MCPMethod, timeout time.Duration) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methodTimeouts[method] = timeout
 	return s
 }
 
-// RegisterTool registers a new tool with the server
-func (s *Server) RegisterTool(tool Tool) error {
+// WithMaxConcurrency limits the number of requests handled at once across
+// all connections. Once the limit is reached, further requests wait for a
+// handler to finish before they start, and may be cancelled while waiting.
+// A limit of zero or less removes it.
+// It must be called before the server starts serving.
+func (s *Server) WithMaxConcurrency(n int) *Server {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if n > 0 {
+		s.sem = make(chan struct{}, n)
+	} else {
+		s.sem = nil
+	}
+	return s
+}
 
+// timeoutFor returns the handler timeout for method
+func (s *Server) timeoutFor(method MCPMethod) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if timeout, ok := s.methodTimeouts[method]; ok {
+		return timeout
+	}
+	return s.timeout
+}
+
+// RegisterTool registers a new tool with the server along with the handler
+// that executes it
+func (s *Server) RegisterTool(tool Tool, handler ToolHandler) error {
+	registered, err := newRegisteredTool(tool, handler)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
 	if _, exists := s.tools[tool.Name]; exists {
+		s.mu.Unlock()
 		return fmt.Errorf("tool %s already registered", tool.Name)
 	}
+	s.tools[tool.Name] = registered
+	s.mu.Unlock()
 
-	s.tools[tool.Name] = tool
+	s.notifyListChanged(ToolsListChanged)
 	return nil
 }
 
-// RegisterResource registers a new resource with the server
-func (s *Server) RegisterResource(resource Resource) error {
+// ReplaceTool registers a tool, replacing any existing tool with the same name
+func (s *Server) ReplaceTool(tool Tool, handler ToolHandler) error {
+	registered, err := newRegisteredTool(tool, handler)
+	if err != nil {
+		return err
+	}
+
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.tools[tool.Name] = registered
+	s.mu.Unlock()
+
+	s.notifyListChanged(ToolsListChanged)
+	return nil
+}
+
+// UnregisterTool removes a tool from the server
+func (s *Server) UnregisterTool(name string) error {
+	s.mu.Lock()
+	if _, exists := s.tools[name]; !exists {
+		s.mu.Unlock()
+		return errorf(CodeToolNotFound, nil, "tool %s not found", name)
+	}
+	delete(s.tools, name)
+	s.mu.Unlock()
+
+	s.notifyListChanged(ToolsListChanged)
+	return nil
+}
 
-	if _, exists := s.resources[resource.URI]; exists {
+// RegisterResource registers a new resource with the server. Its contents
+// start empty and are set by clients with resources/write; use a
+// MemoryProvider to serve resources with fixed contents.
+func (s *Server) RegisterResource(resource Resource) error {
+	if !s.static.add(resource) {
 		return fmt.Errorf("resource %s already registered", resource.URI)
 	}
 
-	s.resources[resource.URI] = resource
+	s.notifyListChanged(ResourcesListChanged)
+	return nil
+}
+
+// ReplaceResource registers a resource, replacing any existing resource with
+// the same URI
+func (s *Server) ReplaceResource(resource Resource) error {
+	s.static.replace(resource)
+
+	s.notifyListChanged(ResourcesListChanged)
+	return nil
+}
+
+// UnregisterResource removes a resource from the server
+func (s *Server) UnregisterResource(uri string) error {
+	if !s.static.Delete(uri) {
+		return errorf(CodeResourceNotFound, nil, "resource %s not found", uri)
+	}
+
+	s.notifyListChanged(ResourcesListChanged)
 	return nil
 }
 
-// RegisterPrompt registers a new prompt with the server
+// RegisterPrompt registers a new prompt with the server. Its templates are
+// parsed here, so syntax errors are reported at registration.
 func (s *Server) RegisterPrompt(prompt Prompt) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.RegisterPromptHandler(prompt, nil)
+}
+
+// RegisterPromptHandler registers a prompt rendered by handler instead of
+// its templates. A nil handler renders the templates.
+func (s *Server) RegisterPromptHandler(prompt Prompt, handler PromptHandler) error {
+	registered, err := newRegisteredPrompt(prompt, handler)
+	if err != nil {
+		return err
+	}
 
+	s.mu.Lock()
 	if _, exists := s.prompts[prompt.Name]; exists {
+		s.mu.Unlock()
 		return fmt.Errorf("prompt %s already registered", prompt.Name)
 	}
+	s.prompts[prompt.Name] = registered
+	s.mu.Unlock()
 
-	s.prompts[prompt.Name] = prompt
+	s.notifyListChanged(PromptsListChanged)
+	return nil
+}
+
+// ReplacePrompt registers a prompt, replacing any existing prompt with the
+// same name
+func (s *Server) ReplacePrompt(prompt Prompt) error {
+	return s.ReplacePromptHandler(prompt, nil)
+}
+
+// ReplacePromptHandler registers a prompt rendered by handler, replacing any
+// existing prompt with the same name
+func (s *Server) ReplacePromptHandler(prompt Prompt, handler PromptHandler) error {
+	registered, err := newRegisteredPrompt(prompt, handler)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.prompts[prompt.Name] = registered
+	s.mu.Unlock()
+
+	s.notifyListChanged(PromptsListChanged)
+	return nil
+}
+
+// UnregisterPrompt removes a prompt from the server
+func (s *Server) UnregisterPrompt(name string) error {
+	s.mu.Lock()
+	if _, exists := s.prompts[name]; !exists {
+		s.mu.Unlock()
+		return errorf(CodePromptNotFound, nil, "prompt %s not found", name)
+	}
+	delete(s.prompts, name)
+	s.mu.Unlock()
+
+	s.notifyListChanged(PromptsListChanged)
 	return nil
 }
 
 // HandleConnection handles a new WebSocket connection
 func (s *Server) HandleConnection(conn *websocket.Conn) {
-	defer conn.Close()
+	s.handleConnection(conn, nil)
+}
+
+// handleConnection serves a WebSocket connection opened by principal
+func (s *Server) handleConnection(conn *websocket.Conn, principal *Principal) {
+	if err := s.serveTransport(NewWebSocketTransport(conn), principal); err != nil {
+		s.log().Error("error reading message", "err", err)
+	}
+}
+
+// ServeStdio serves a single client over the process's stdin and stdout,
+// returning once stdin is closed
+func (s *Server) ServeStdio() error {
+	return s.ServeTransport(NewStdioTransport(os.Stdin, os.Stdout))
+}
+
+// ServeTransport serves a single client over t until the transport is closed.
+// It returns nil when the peer or the server closes the connection cleanly.
+//
+// Requests are handled concurrently, each in its own goroutine, and their
+// responses are written as they complete, so they may arrive out of order;
+// clients match them by ID. Notifications are handled in the order received.
+// The responses to a JSON-RPC batch are written together as one array once
+// every request in it has completed.
+func (s *Server) ServeTransport(t Transport) error {
+	return s.serveTransport(t, nil)
+}
+
+// serveTransport serves t for a client already authenticated as principal,
+// which is nil if the client has yet to authenticate
+func (s *Server) serveTransport(t Transport, principal *Principal) error {
+	defer t.Close()
 
 	s.mu.Lock()
-	s.clients[conn] = &ClientState{}
+	if s.closing {
+		s.mu.Unlock()
+		return nil
+	}
+	state := &ClientState{
+		Principal:     principal,
+		conn:          t,
+		requests:      make(map[string]context.CancelCauseFunc),
+		pending:       make(map[string]chan *MCPMessage),
+		subscriptions: make(map[string]bool),
+		done:          make(chan struct{}),
+	}
+	s.clients[t] = state
 	s.mu.Unlock()
 
+	// Handlers are cancelled when the connection goes away, and the
+	// connection is not released until they have returned
+	ctx, cancel := context.WithCancel(withLogger(context.Background(), s.sessionLogger(state)))
+	var handlers sync.WaitGroup
 	defer func() {
+		cancel()
+		handlers.Wait()
+
 		s.mu.Lock()
-		delete(s.clients, conn)
+		delete(s.clients, t)
 		s.mu.Unlock()
+		close(state.done)
 	}()
 
 	for {
-		var msg MCPMessage
-		if err := conn.ReadJSON(&msg); err != nil {
-			log.Printf("error reading message: %v", err)
-			return
+		data, err := t.ReadMessage()
+		if err != nil {
+			s.mu.RLock()
+			closing := s.closing
+			s.mu.RUnlock()
+			if closing || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
 		}
 
-		// Set the connection for the message
-		msg.Conn = conn
+		if isBatch(data) {
+			if !s.serveBatch(ctx, state, data, &handlers) {
+				return nil
+			}
+			continue
+		}
 
-		handler, ok := s.handlers[msg.Method]
-		if !ok {
-			s.sendError(conn, msg.ID, -32601, "method not found")
+		var msg MCPMessage
+		if err := sonic.Unmarshal(data, &msg); err != nil {
+			s.sendError(t, nil, NewError(CodeParseError, "parse error", err.Error()))
 			continue
 		}
+		if !s.dispatch(ctx, state, t, &msg, &handlers) {
+			return nil
+		}
+	}
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		response, err := handler(ctx, &msg)
-		cancel()
+// dispatch handles a message received from the client on state's connection,
+// writing any response to reply. Requests are run in a goroutine tracked by
+// handlers. It returns false once the server has begun shutting down.
+func (s *Server) dispatch(ctx context.Context, state *ClientState, reply Transport, msg *MCPMessage, handlers *sync.WaitGroup) bool {
+	// Set the connection for the message
+	msg.Conn = state.conn
 
-		if err != nil {
-			s.sendError(conn, msg.ID, -32000, err.Error())
-			continue
+	// Messages without a method are responses to server-initiated requests
+	if msg.Method == "" {
+		s.deliverResponse(state, msg)
+		return true
+	}
+
+	handler, ok := s.handler(msg.Method)
+	if !ok {
+		s.sendError(reply, msg.ID, errorf(CodeMethodNotFound, nil, "method %s not found", msg.Method))
+		return true
+	}
+
+	s.mu.RLock()
+	initialized := state.Initialized
+	sem := s.sem
+	s.mu.RUnlock()
+	if !initialized && !allowedBeforeInitialized(msg.Method) {
+		if msg.ID != nil {
+			s.sendError(reply, msg.ID, ErrServerNotInitialized)
 		}
+		return true
+	}
+
+	// Stop accepting work once shutdown has begun
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		return false
+	}
+	s.inflight.Add(1)
+	s.mu.Unlock()
 
-		if response != nil {
-			if err := conn.WriteJSON(response); err != nil {
-				log.Printf("error writing response: %v", err)
+	if msg.ID == nil {
+		s.handleMessage(ctx, reply, handler, msg)
+		s.inflight.Done()
+		return true
+	}
+
+	// Register the request before dispatching it so a cancellation that
+	// arrives straight after it is not missed
+	key := idKey(msg.ID)
+	reqCtx, reqCancel := context.WithCancelCause(ctx)
+	s.mu.Lock()
+	state.requests[key] = reqCancel
+	s.mu.Unlock()
+
+	handlers.Add(1)
+	go func() {
+		defer handlers.Done()
+		defer s.inflight.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(state.requests, key)
+			s.mu.Unlock()
+			reqCancel(nil)
+		}()
+
+		// Wait for a slot here rather than in the read loop, which must keep
+		// reading cancellations and responses to the server's own requests
+		if sem != nil {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-reqCtx.Done():
 				return
 			}
 		}
+		s.handleMessage(reqCtx, reply, handler, msg)
+	}()
+	return true
+}
+
+// handleMessage runs the handler for msg and writes its response or error
+// back to the transport. A failed write closes the transport, which ends the
+// connection's read loop.
+func (s *Server) handleMessage(ctx context.Context, t Transport, handler HandlerFunc, msg *MCPMessage) {
+	reqCtx, cancel := context.WithTimeout(ctx, s.timeoutFor(msg.Method))
+	response, err := handler(reqCtx, msg)
+	cancel()
+
+	if context.Cause(ctx) == errRequestCancelled {
+		// The client has abandoned the request and expects no response
+		return
+	}
+
+	if msg.ID == nil {
+		// Notifications never receive a response
+		if err != nil {
+			LoggerFromContext(ctx).Error("error handling notification", "method", msg.Method, "err", err)
+		}
+		return
+	}
+
+	if err != nil {
+		var mcpErr *MCPError
+		if !errors.As(err, &mcpErr) {
+			mcpErr = NewError(CodeServerError, err.Error(), nil)
+		}
+		s.sendError(t, msg.ID, mcpErr)
+		return
+	}
+
+	if response == nil {
+		return
+	}
+	if response.ID == nil {
+		response.ID = msg.ID
+	}
+	if err := writeJSON(t, response); err != nil {
+		s.log().Error("error writing response", "method", msg.Method, "err", err)
+		t.Close()
 	}
 }
 
-func (s *Server) sendError(conn *websocket.Conn, id interface{}, code int, message string) {
+// Shutdown stops accepting new requests, waits for in-flight requests to
+// finish and then closes all client connections. If ctx expires before the
+// requests drain, the connections are closed anyway and ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+	s.stopWatch()
+
+	drained := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	s.mu.RLock()
+	transports := make([]Transport, 0, len(s.clients))
+	for t := range s.clients {
+		transports = append(transports, t)
+	}
+	s.mu.RUnlock()
+
+	for _, t := range transports {
+		if closeErr := t.Close(); closeErr != nil {
+			s.log().Error("error closing connection", "err", closeErr)
+		}
+	}
+
+	return err
+}
+
+func (s *Server) sendError(t Transport, id interface{}, mcpErr *MCPError) {
 	response := MCPMessage{
 		JSONRPC: "2.0",
 		ID:      id,
-		Error: &MCPError{
-			Code:    code,
-			Message: message,
+		Error:   mcpErr,
+	}
+
+	if err := writeJSON(t, response); err != nil {
+		s.log().Error("error sending error response", "code", mcpErr.Code, "err", err)
+	}
+}
+
+// allowedBeforeInitialized reports whether method may be used before the
+// client has sent the initialized notification
+func allowedBeforeInitialized(method MCPMethod) bool {
+	switch method {
+	case Initialize, Initialized, CancelRequest, Ping:
+		return true
+	}
+	return false
+}
+
+// negotiateProtocolVersion returns requested if the server supports it and
+// the latest supported version otherwise, leaving the client to decide
+// whether it can continue
+func negotiateProtocolVersion(requested string) string {
+	if slices.Contains(supportedProtocolVersions, requested) {
+		return requested
+	}
+	return ProtocolVersion
+}
+
+// serverCapabilities derives the advertised capabilities from what is
+// registered, merged with those declared with WithCapabilities. The caller
+// must hold s.mu.
+func (s *Server) serverCapabilities() ServerCapabilities {
+	resourceTypes := s.static.types()
+	for _, p := range s.providers {
+		resourceTypes = append(resourceTypes, p.resourceType)
+	}
+	for _, t := range s.templates {
+		resourceTypes = append(resourceTypes, t.Type)
+	}
+
+	caps := ServerCapabilities{
+		Tools: ToolsServerCapabilities{
+			Supported:   len(s.tools) > 0 || s.capabilities.Tools.Supported,
+			Types:       s.capabilities.Tools.Types,
+			ListChanged: true,
+		},
+		Resources: ResourcesServerCapabilities{
+			Supported:   len(resourceTypes) > 0 || s.capabilities.Resources.Supported,
+			Types:       s.capabilities.Resources.Types,
+			ListChanged: true,
+			Subscribe:   true,
 		},
+		Prompts: PromptsServerCapabilities{
+			Supported:   len(s.prompts) > 0 || s.capabilities.Prompts.Supported,
+			Types:       s.capabilities.Prompts.Types,
+			ListChanged: true,
+		},
+		Logging: LoggingServerCapabilities{Supported: true},
 	}
 
-	if err := conn.WriteJSON(response); err != nil {
-		log.Printf("error sending error response: %v", err)
+	if caps.Tools.Supported && len(caps.Tools.Types) == 0 {
+		caps.Tools.Types = []string{"function"}
 	}
+	if len(caps.Resources.Types) == 0 {
+		for _, resourceType := range resourceTypes {
+			if resourceType != "" && !slices.Contains(caps.Resources.Types, resourceType) {
+				caps.Resources.Types = append(caps.Resources.Types, resourceType)
+			}
+		}
+		slices.Sort(caps.Resources.Types)
+	}
+
+	return caps
 }
 
 // Handler implementations
 func (s *Server) handleInitialize(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
 	var params InitializeParams
 	if err := sonic.Unmarshal(msg.Params, &params); err != nil {
-		return nil, fmt.Errorf("invalid initialize params: %w", err)
+		return nil, NewError(CodeInvalidParams, "invalid initialize params", err.Error())
 	}
 
 	s.mu.Lock()
-	if client, ok := s.clients[msg.Conn]; ok {
+	client, ok := s.clients[msg.Conn]
+	if ok && client.ProtocolVersion != "" {
+		s.mu.Unlock()
+		return nil, NewError(CodeInvalidRequest, "client already initialized", nil)
+	}
+
+	authenticator := s.authenticator
+	needsAuth := ok && authenticator != nil && client.Principal == nil
+	s.mu.Unlock()
+
+	var principal *Principal
+	if needsAuth {
+		var err error
+		principal, err = authenticator.Authenticate(ctx, Credentials{Token: params.AuthToken})
+		if err != nil {
+			return nil, NewError(CodeUnauthorized, "unauthorized", err.Error())
+		}
+	}
+
+	// Authentication ran without the lock, so check again for a concurrent
+	// initialize
+	s.mu.Lock()
+	if ok && client.ProtocolVersion != "" {
+		s.mu.Unlock()
+		return nil, NewError(CodeInvalidRequest, "client already initialized", nil)
+	}
+
+	version := negotiateProtocolVersion(params.ProtocolVersion)
+	if ok {
+		if principal != nil {
+			client.Principal = principal
+			// Later requests for an SSE session are checked against it
+			if session, isSSE := msg.Conn.(*sseSession); isSSE {
+				session.principal = principal
+			}
+		}
 		client.Capabilities = params.Capabilities
 		client.RootURI = params.RootURI
+		client.ProtocolVersion = version
+		client.ClientInfo = params.ClientInfo
+	}
+
+	result := InitializeResult{
+		ProtocolVersion: version,
+		Capabilities:    s.serverCapabilities(),
+		ServerInfo:      s.info,
 	}
 	s.mu.Unlock()
 
-	response := MCPMessage{
-		JSONRPC: "2.0",
-		ID:      msg.ID,
-		Result: json.RawMessage(`{
-			"capabilities": {
-				"tools": {
-					"supported": true,
-					"types": ["function"]
-				},
-				"resources": {
-					"supported": true,
-					"types": ["file", "memory"]
-				},
-				"prompts": {
-					"supported": true,
-					"types": ["text", "chat"]
-				}
-			}
-		}`),
+	resultBytes, err := sonic.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling initialize result: %w", err)
 	}
 
-	return &response, nil
+	return &MCPMessage{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  resultBytes,
+	}, nil
 }
 
 func (s *Server) handleInitialized(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
 	s.mu.Lock()
-	if client, ok := s.clients[msg.Conn]; ok {
+	// Only complete initialization that was started with an initialize request
+	if client, ok := s.clients[msg.Conn]; ok && client.ProtocolVersion != "" {
 		client.Initialized = true
 	}
 	s.mu.Unlock()
@@ -227,44 +852,118 @@ func (s *Server) handleInitialized(ctx context.Context, msg *MCPMessage) (*MCPMe
 	return nil, nil
 }
 
+// handlePing answers a ping from either side of the connection
+func handlePing(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	return &MCPMessage{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+		Result:  json.RawMessage(`{}`),
+	}, nil
+}
+
+func (s *Server) handleCancelRequest(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	var params CancelParams
+	if err := sonic.Unmarshal(msg.Params, &params); err != nil {
+		return nil, NewError(CodeInvalidParams, "invalid cancel params", err.Error())
+	}
+
+	s.mu.RLock()
+	var cancel context.CancelCauseFunc
+	if client, ok := s.clients[msg.Conn]; ok {
+		cancel = client.requests[idKey(params.ID)]
+	}
+	s.mu.RUnlock()
+
+	// The request may already have completed
+	if cancel != nil {
+		cancel(errRequestCancelled)
+	}
+
+	return nil, nil
+}
+
 func (s *Server) handleToolsList(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	params, size, err := s.listParams(msg)
+	if err != nil {
+		return nil, err
+	}
+	policy, principal := s.access(msg)
+
 	s.mu.RLock()
 	tools := make([]Tool, 0, len(s.tools))
 	for _, tool := range s.tools {
-		tools = append(tools, tool)
+		tools = append(tools, tool.Tool)
 	}
 	s.mu.RUnlock()
 
-	result, err := sonic.Marshal(map[string]interface{}{
-		"tools": tools,
-	})
+	page, next, err := paginate(tools, params.Cursor, size,
+		func(t Tool) string { return t.Name },
+		func(t Tool) bool { return policy.AllowTool(principal, t.Name) && params.matches(t.Tags, t.Name) })
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling tools: %w", err)
+		return nil, err
 	}
-
-	return &MCPMessage{
-		JSONRPC: "2.0",
-		ID:      msg.ID,
-		Result:  result,
-	}, nil
+	return listResponse(msg, "tools", page, next)
 }
 
 func (s *Server) handleToolsCall(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
 	var params ToolCallParams
 	if err := sonic.Unmarshal(msg.Params, &params); err != nil {
-		return nil, fmt.Errorf("invalid tool call params: %w", err)
+		return nil, NewError(CodeInvalidParams, "invalid tool call params", err.Error())
+	}
+
+	policy, principal := s.access(msg)
+	if !policy.AllowTool(principal, params.Name) {
+		return nil, forbidden("tool", params.Name)
 	}
 
 	s.mu.RLock()
-	_, exists := s.tools[params.Name]
+	tool, exists := s.tools[params.Name]
+	validateResults := s.validateResults
 	s.mu.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("tool %s not found", params.Name)
+		return nil, errorf(CodeToolNotFound, map[string]interface{}{"tool": params.Name}, "tool %s not found", params.Name)
+	}
+
+	arguments := params.Arguments
+	if len(arguments) == 0 || string(arguments) == "null" {
+		arguments = json.RawMessage(`{}`)
+	}
+	if errs := tool.params.Validate(arguments); len(errs) > 0 {
+		return nil, validationError(CodeInvalidParams, params.Name, "invalid tool arguments", errs)
+	}
+	ctx = withPrincipal(ctx, principal)
+
+	s.mu.RLock()
+	if client, ok := s.clients[msg.Conn]; ok {
+		ctx = withSampler(ctx, s, client)
 	}
+	s.mu.RUnlock()
 
-	// TODO: Implement actual tool execution
-	result := json.RawMessage(`{"status": "success"}`)
+	if params.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, params.Timeout)
+		defer cancel()
+	}
+	if params.ProgressToken != "" {
+		ctx = withProgress(ctx, msg.Conn, params.ProgressToken)
+	}
+
+	output, err := runTool(ctx, tool.handler, params.Arguments)
+	if err != nil {
+		return nil, toolError(params, err)
+	}
+
+	result, err := sonic.Marshal(output)
+	if err != nil {
+		return nil, toolError(params, fmt.Errorf("error marshaling tool result: %w", err))
+	}
+
+	if validateResults {
+		if errs := tool.returns.Validate(result); len(errs) > 0 {
+			return nil, validationError(CodeInternalError, params.Name, "tool result does not match its returns schema", errs)
+		}
+	}
 
 	return &MCPMessage{
 		JSONRPC: "2.0",
@@ -273,19 +972,106 @@ func (s *Server) handleToolsCall(ctx context.Context, msg *MCPMessage) (*MCPMess
 	}, nil
 }
 
+// runTool runs a tool handler, returning early if ctx is done before the
+// handler finishes so a handler that ignores its context cannot block the call
+func runTool(ctx context.Context, handler ToolHandler, arguments json.RawMessage) (interface{}, error) {
+	type toolResult struct {
+		output interface{}
+		err    error
+	}
+
+	done := make(chan toolResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- toolResult{err: fmt.Errorf("tool panicked: %v", r)}
+			}
+		}()
+		output, err := handler(ctx, arguments)
+		done <- toolResult{output: output, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-done:
+		return res.output, res.err
+	}
+}
+
+// validationError reports schema validation failures for a tool call, listing
+// each failing path in the error data
+func validationError(code int, tool, message string, errs []ValidationError) *MCPError {
+	details := make([]string, len(errs))
+	for i, err := range errs {
+		details[i] = err.Error()
+	}
+
+	return errorf(code, map[string]interface{}{
+		"tool":   tool,
+		"errors": errs,
+	}, "%s for tool %s: %s", message, tool, strings.Join(details, "; "))
+}
+
+// toolError converts a tool handler failure into a JSON-RPC error that carries
+// the tool name and underlying cause in its data
+func toolError(params ToolCallParams, err error) *MCPError {
+	var mcpErr *MCPError
+	if errors.As(err, &mcpErr) {
+		return mcpErr
+	}
+
+	data := map[string]interface{}{
+		"tool":  params.Name,
+		"error": err.Error(),
+	}
+	if errors.Is(err, context.DeadlineExceeded) && params.Timeout > 0 {
+		data["timeout"] = params.Timeout.String()
+	}
+
+	return errorf(CodeServerError, data, "tool %s failed: %v", params.Name, err)
+}
+
 func (s *Server) handleResourcesList(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	params, size, err := s.listParams(msg)
+	if err != nil {
+		return nil, err
+	}
+	policy, principal := s.access(msg)
+
+	resources, err := s.listResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	page, next, err := paginate(resources, params.Cursor, size,
+		func(r Resource) string { return r.URI },
+		func(r Resource) bool {
+			return policy.AllowResource(principal, r.URI, ReadAccess) && params.matches(r.Tags, r.URI, r.Name)
+		})
+	if err != nil {
+		return nil, err
+	}
+	return listResponse(msg, "resources", page, next)
+}
+
+func (s *Server) handleResourcesTemplatesList(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	policy, principal := s.access(msg)
+
 	s.mu.RLock()
-	resources := make([]Resource, 0, len(s.resources))
-	for _, resource := range s.resources {
-		resources = append(resources, resource)
+	templates := make([]ResourceTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		if policy.AllowResource(principal, t.URITemplate, ReadAccess) {
+			templates = append(templates, t.ResourceTemplate)
+		}
 	}
 	s.mu.RUnlock()
 
 	result, err := sonic.Marshal(map[string]interface{}{
-		"resources": resources,
+		"resourceTemplates": templates,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling resources: %w", err)
+		return nil, fmt.Errorf("error marshaling resource templates: %w", err)
 	}
 
 	return &MCPMessage{
@@ -300,19 +1086,20 @@ func (s *Server) handleResourcesRead(ctx context.Context, msg *MCPMessage) (*MCP
 		URI string `json:"uri"`
 	}
 	if err := sonic.Unmarshal(msg.Params, &params); err != nil {
-		return nil, fmt.Errorf("invalid resource read params: %w", err)
+		return nil, NewError(CodeInvalidParams, "invalid resource read params", err.Error())
 	}
 
-	s.mu.RLock()
-	resource, ok := s.resources[params.URI]
-	s.mu.RUnlock()
+	if policy, principal := s.access(msg); !policy.AllowResource(principal, params.URI, ReadAccess) {
+		return nil, forbidden("resource", params.URI)
+	}
 
-	if !ok {
-		return nil, fmt.Errorf("resource %s not found", params.URI)
+	contents, err := s.readResource(ctx, params.URI)
+	if err != nil {
+		return nil, err
 	}
 
 	result, err := sonic.Marshal(map[string]interface{}{
-		"resource": resource,
+		"contents": []ResourceContents{*contents},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling resource: %w", err)
@@ -326,22 +1113,21 @@ func (s *Server) handleResourcesRead(ctx context.Context, msg *MCPMessage) (*MCP
 }
 
 func (s *Server) handleResourcesWrite(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
-	var params struct {
-		URI     string      `json:"uri"`
-		Content interface{} `json:"content"`
-	}
+	var params ResourceContents
 	if err := sonic.Unmarshal(msg.Params, &params); err != nil {
-		return nil, fmt.Errorf("invalid resource write params: %w", err)
+		return nil, NewError(CodeInvalidParams, "invalid resource write params", err.Error())
 	}
 
-	s.mu.Lock()
-	if resource, ok := s.resources[params.URI]; ok {
-		resource.Metadata = params.Content
-		s.resources[params.URI] = resource
-	} else {
-		return nil, fmt.Errorf("resource %s not found", params.URI)
+	if policy, principal := s.access(msg); !policy.AllowResource(principal, params.URI, WriteAccess) {
+		return nil, forbidden("resource", params.URI)
+	}
+
+	if err := s.writeResource(ctx, params); err != nil {
+		return nil, err
+	}
+	if err := s.NotifyResourceUpdated(params.URI); err != nil {
+		LoggerFromContext(ctx).Error("error sending notification", "type", ResourceUpdated, "err", err)
 	}
-	s.mu.Unlock()
 
 	return &MCPMessage{
 		JSONRPC: "2.0",
@@ -351,34 +1137,36 @@ func (s *Server) handleResourcesWrite(ctx context.Context, msg *MCPMessage) (*MC
 }
 
 func (s *Server) handlePromptsList(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	params, size, err := s.listParams(msg)
+	if err != nil {
+		return nil, err
+	}
+	policy, principal := s.access(msg)
+
 	s.mu.RLock()
 	prompts := make([]Prompt, 0, len(s.prompts))
 	for _, prompt := range s.prompts {
-		prompts = append(prompts, prompt)
+		prompts = append(prompts, prompt.Prompt)
 	}
 	s.mu.RUnlock()
 
-	result, err := sonic.Marshal(map[string]interface{}{
-		"prompts": prompts,
-	})
+	page, next, err := paginate(prompts, params.Cursor, size,
+		func(p Prompt) string { return p.Name },
+		func(p Prompt) bool { return policy.AllowPrompt(principal, p.Name) && params.matches(p.Tags, p.Name) })
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling prompts: %w", err)
+		return nil, err
 	}
-
-	return &MCPMessage{
-		JSONRPC: "2.0",
-		ID:      msg.ID,
-		Result:  result,
-	}, nil
+	return listResponse(msg, "prompts", page, next)
 }
 
 func (s *Server) handlePromptsRender(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
-	var params struct {
-		Name      string                 `json:"name"`
-		Variables map[string]interface{} `json:"variables"`
-	}
+	var params PromptRenderParams
 	if err := sonic.Unmarshal(msg.Params, &params); err != nil {
-		return nil, fmt.Errorf("invalid prompt render params: %w", err)
+		return nil, NewError(CodeInvalidParams, "invalid prompt render params", err.Error())
+	}
+
+	if policy, principal := s.access(msg); !policy.AllowPrompt(principal, params.Name) {
+		return nil, forbidden("prompt", params.Name)
 	}
 
 	s.mu.RLock()
@@ -386,18 +1174,15 @@ func (s *Server) handlePromptsRender(ctx context.Context, msg *MCPMessage) (*MCP
 	s.mu.RUnlock()
 
 	if !ok {
-		return nil, fmt.Errorf("prompt %s not found", params.Name)
+		return nil, errorf(CodePromptNotFound, map[string]interface{}{"prompt": params.Name}, "prompt %s not found", params.Name)
 	}
 
-	// Simple template rendering - in a real implementation, you'd want to use a proper template engine
-	rendered := prompt.Template
-	for key, value := range params.Variables {
-		rendered = strings.ReplaceAll(rendered, "{{"+key+"}}", fmt.Sprintf("%v", value))
+	rendered, err := prompt.render(ctx, params.Arguments)
+	if err != nil {
+		return nil, err
 	}
 
-	result, err := sonic.Marshal(map[string]interface{}{
-		"rendered": rendered,
-	})
+	result, err := sonic.Marshal(rendered)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling rendered prompt: %w", err)
 	}
@@ -0,0 +1,1040 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandleToolsCall(t *testing.T) {
+	type addArgs struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}
+
+	s := NewServer()
+	tools := map[string]ToolHandler{
+		"add": TypedToolHandler(func(ctx context.Context, args addArgs) (interface{}, error) {
+			return map[string]int{"sum": args.A + args.B}, nil
+		}),
+		"fail": func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+			return nil, errors.New("boom")
+		},
+		"slow": func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+			time.Sleep(time.Second)
+			return "done", nil
+		},
+	}
+	for name, handler := range tools {
+		if err := s.RegisterTool(Tool{Name: name}, handler); err != nil {
+			t.Fatalf("RegisterTool(%s) error = %v", name, err)
+		}
+	}
+	err := s.RegisterTool(Tool{
+		Name: "checked_add",
+		Parameters: map[string]interface{}{
+			"type":     "object",
+			"required": []string{"a", "b"},
+			"properties": map[string]interface{}{
+				"a": map[string]interface{}{"type": "integer"},
+				"b": map[string]interface{}{"type": "integer"},
+			},
+		},
+	}, tools["add"])
+	if err != nil {
+		t.Fatalf("RegisterTool(checked_add) error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		params   ToolCallParams
+		want     string
+		wantCode int
+	}{
+		{
+			name:   "typed arguments",
+			params: ToolCallParams{Name: "add", Arguments: json.RawMessage(`{"a":2,"b":3}`)},
+			want:   `{"sum":5}`,
+		},
+		{
+			name:     "invalid arguments",
+			params:   ToolCallParams{Name: "add", Arguments: json.RawMessage(`{"a":"two"}`)},
+			wantCode: CodeInvalidParams,
+		},
+		{
+			name:     "handler error",
+			params:   ToolCallParams{Name: "fail"},
+			wantCode: CodeServerError,
+		},
+		{
+			name:     "timeout",
+			params:   ToolCallParams{Name: "slow", Timeout: 10 * time.Millisecond},
+			wantCode: CodeServerError,
+		},
+		{
+			name:     "schema violation",
+			params:   ToolCallParams{Name: "checked_add", Arguments: json.RawMessage(`{"a":1.5}`)},
+			wantCode: CodeInvalidParams,
+		},
+		{
+			name:     "unknown tool",
+			params:   ToolCallParams{Name: "missing"},
+			wantCode: CodeToolNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := json.Marshal(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := s.handleToolsCall(context.Background(), &MCPMessage{ID: 1, Params: params})
+			if tt.wantCode != 0 {
+				var mcpErr *MCPError
+				if !errors.As(err, &mcpErr) || mcpErr.Code != tt.wantCode {
+					t.Fatalf("handleToolsCall() error = %v, want code %d", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handleToolsCall() error = %v", err)
+			}
+			if string(resp.Result) != tt.want {
+				t.Errorf("handleToolsCall() result = %s, want %s", resp.Result, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterFuncResultValidation(t *testing.T) {
+	type listResult struct {
+		Items  []string          `json:"items"`
+		Labels map[string]string `json:"labels"`
+		Next   *int              `json:"next"`
+		Count  int               `json:"count"`
+	}
+
+	s := NewServer().WithResultValidation(true)
+	err := RegisterFunc(s, "list", "Lists items", func(ctx context.Context, args struct {
+		Full bool `json:"full"`
+	}) (listResult, error) {
+		if !args.Full {
+			return listResult{}, nil
+		}
+		next := 2
+		return listResult{Items: []string{"a"}, Labels: map[string]string{"a": "b"}, Next: &next, Count: 1}, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunc() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{name: "zero value", args: `{"full":false}`, want: `{"items":null,"labels":null,"next":null,"count":0}`},
+		{name: "populated", args: `{"full":true}`, want: `{"items":["a"],"labels":{"a":"b"},"next":2,"count":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := json.Marshal(ToolCallParams{Name: "list", Arguments: json.RawMessage(tt.args)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := s.handleToolsCall(context.Background(), &MCPMessage{ID: 1, Params: params})
+			if err != nil {
+				t.Fatalf("handleToolsCall() error = %v", err)
+			}
+			if string(resp.Result) != tt.want {
+				t.Errorf("handleToolsCall() result = %s, want %s", resp.Result, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrentDispatch(t *testing.T) {
+	s := NewServer().WithMethodTimeout(ToolsCall, 5*time.Second)
+	release := make(chan struct{})
+	err := s.RegisterTool(Tool{Name: "slow"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		<-release
+		return "slow", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RegisterTool(Tool{Name: "fast"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		return "fast", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := connect(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := client.CallTool(ctx, "slow", nil)
+		slow <- err
+	}()
+
+	// The fast call must complete while the slow one is still blocked
+	result, err := client.CallTool(ctx, "fast", nil)
+	if err != nil {
+		t.Fatalf("CallTool(fast) error = %v", err)
+	}
+	if string(result) != `"fast"` {
+		t.Errorf("CallTool(fast) = %s, want %q", result, `"fast"`)
+	}
+
+	close(release)
+	if err := <-slow; err != nil {
+		t.Errorf("CallTool(slow) error = %v", err)
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	s := NewServer()
+	cancelled := make(chan struct{})
+	err := s.RegisterTool(Tool{Name: "wait"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := connect(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.CallTool(ctx, "wait", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CallTool() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("tool handler was not cancelled")
+	}
+}
+
+func TestCancelAtConcurrencyLimit(t *testing.T) {
+	s := NewServer().WithMaxConcurrency(1).WithMethodTimeout(ToolsCall, 10*time.Second)
+	started := make(chan struct{}, 1)
+	stopped := make(chan error, 1)
+	err := s.RegisterTool(Tool{Name: "wait"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RegisterTool(Tool{Name: "fast"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		return "fast", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := connect(t, s)
+
+	waitCtx, cancelWait := context.WithCancel(context.Background())
+	defer cancelWait()
+	go client.CallTool(waitCtx, "wait", nil)
+	<-started
+
+	// A request queued behind the limit can be abandoned
+	queuedCtx, cancelQueued := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelQueued()
+	if _, err := client.CallTool(queuedCtx, "fast", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CallTool(fast) error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The running request's cancellation must still be read, rather than
+	// the handler running until it times out
+	cancelWait()
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("tool handler stopped with %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("tool handler was not cancelled")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.CallTool(ctx, "fast", nil); err != nil {
+		t.Errorf("CallTool(fast) after cancellation error = %v", err)
+	}
+}
+
+func TestToolProgress(t *testing.T) {
+	s := NewServer()
+	err := s.RegisterTool(Tool{Name: "index"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		progress := ProgressFromContext(ctx)
+		for i := 1; i <= 3; i++ {
+			if err := progress.Report(float64(i), 3, "indexing"); err != nil {
+				return nil, err
+			}
+		}
+		return "indexed", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := connect(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var reports []float64
+	_, err = client.CallTool(ctx, "index", nil, WithProgress(func(progress, total float64, message string) {
+		reports = append(reports, progress)
+	}))
+	if err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+	if len(reports) != 3 || reports[2] != 3 {
+		t.Errorf("progress reports = %v, want [1 2 3]", reports)
+	}
+}
+
+func TestServerToClient(t *testing.T) {
+	s := NewServer()
+	client := connect(t, s)
+
+	notified := make(chan NotificationParams, 1)
+	client.RegisterNotificationHandler(func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+		var params NotificationParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		notified <- params
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clients := s.Clients()
+	if len(clients) != 1 {
+		t.Fatalf("Clients() = %d clients, want 1", len(clients))
+	}
+
+	roots, err := s.ListRoots(ctx, clients[0])
+	if err != nil {
+		t.Fatalf("ListRoots() error = %v", err)
+	}
+	if len(roots) != 1 || roots[0].URI != "file:///workspace" {
+		t.Errorf("ListRoots() = %v, want file:///workspace", roots)
+	}
+
+	// The client answered roots/list after sending initialized, so it is
+	// now eligible for broadcasts
+	if err := s.Broadcast(NotificationParams{Type: "hello", Message: "world"}); err != nil {
+		t.Fatalf("Broadcast() error = %v", err)
+	}
+	select {
+	case params := <-notified:
+		if params.Type != "hello" {
+			t.Errorf("notification type = %q, want %q", params.Type, "hello")
+		}
+	case <-ctx.Done():
+		t.Fatal("notification not received")
+	}
+}
+
+func TestToolsListChanged(t *testing.T) {
+	noop := func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		return nil, nil
+	}
+
+	s := NewServer()
+	if err := s.RegisterTool(Tool{Name: "first"}, noop); err != nil {
+		t.Fatal(err)
+	}
+
+	client := connect(t, s)
+
+	changed := make(chan []Tool, 1)
+	client.OnToolsChanged(func(tools []Tool) {
+		changed <- tools
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if tools, err := client.ListTools(ctx); err != nil || len(tools) != 1 {
+		t.Fatalf("ListTools() = %v, %v, want 1 tool", tools, err)
+	}
+
+	if err := s.RegisterTool(Tool{Name: "second"}, noop); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case tools := <-changed:
+		if len(tools) != 2 {
+			t.Errorf("refreshed tools = %v, want 2 tools", tools)
+		}
+	case <-ctx.Done():
+		t.Fatal("tools list was not refreshed")
+	}
+
+	if tools, err := client.ListTools(ctx); err != nil || len(tools) != 2 {
+		t.Errorf("ListTools() after change = %v, %v, want 2 tools", tools, err)
+	}
+}
+
+func TestInitializeNegotiation(t *testing.T) {
+	s := NewServer().WithInfo("test-server", "1.2.3")
+	serverSide, clientSide := pipeTransports()
+	go s.ServeTransport(serverSide)
+	client := NewClientWithTransport(clientSide, ClientCapabilities{})
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.ListTools(ctx); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("ListTools() before Initialize error = %v, want %v", err, ErrNotInitialized)
+	}
+
+	// The server rejects requests that bypass the client-side check
+	if _, err := client.sendRequest(ctx, ToolsList, nil); !errors.Is(err, ErrServerNotInitialized) {
+		t.Errorf("tools/list before initialize error = %v, want %v", err, ErrServerNotInitialized)
+	}
+
+	caps, err := client.Initialize(ctx, "")
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if caps.Tools.Supported {
+		t.Error("server without tools advertised tool support")
+	}
+
+	result := client.InitializeResult()
+	if result.ProtocolVersion != ProtocolVersion || result.ServerInfo.Name != "test-server" {
+		t.Errorf("InitializeResult() = %+v", result)
+	}
+
+	if _, err := client.ListTools(ctx); !errors.Is(err, ErrCapabilityNotSupported) {
+		t.Errorf("ListTools() error = %v, want %v", err, ErrCapabilityNotSupported)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	noop := func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		return nil, nil
+	}
+
+	s := NewServer().WithPageSize(2)
+	for _, tool := range []Tool{
+		{Name: "search_web", Tags: []string{"search"}},
+		{Name: "add", Tags: []string{"math"}},
+		{Name: "search_docs", Tags: []string{"search", "docs"}},
+		{Name: "multiply", Tags: []string{"math"}},
+		{Name: "echo"},
+	} {
+		if err := s.RegisterTool(tool, noop); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts []ListOption
+		want []string
+	}{
+		{name: "all pages", want: []string{"add", "echo", "multiply", "search_docs", "search_web"}},
+		{name: "name prefix", opts: []ListOption{WithNameFilter("search_*")}, want: []string{"search_docs", "search_web"}},
+		{name: "tags", opts: []ListOption{WithTags("search", "docs")}, want: []string{"search_docs"}},
+		{name: "no match", opts: []ListOption{WithNameFilter("missing")}, want: []string{}},
+	}
+
+	client := connect(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tools, err := client.ListTools(ctx, tt.opts...)
+			if err != nil {
+				t.Fatalf("ListTools() error = %v", err)
+			}
+			names := make([]string, 0, len(tools))
+			for _, tool := range tools {
+				names = append(names, tool.Name)
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("ListTools() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+
+	// A single page carries the cursor of the next one
+	resp, err := s.handleToolsList(context.Background(), &MCPMessage{ID: 1, Params: json.RawMessage(`{"limit":1}`)})
+	if err != nil {
+		t.Fatalf("handleToolsList() error = %v", err)
+	}
+	var page struct {
+		Tools      []Tool `json:"tools"`
+		NextCursor string `json:"nextCursor"`
+	}
+	if err := json.Unmarshal(resp.Result, &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Tools) != 1 || page.NextCursor == "" {
+		t.Errorf("tools/list with limit 1 = %s, want one tool and a cursor", resp.Result)
+	}
+
+	_, err = s.handleToolsList(context.Background(), &MCPMessage{ID: 2, Params: json.RawMessage(`{"cursor":"!"}`)})
+	if !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("tools/list with bad cursor error = %v, want %v", err, ErrInvalidParams)
+	}
+}
+
+func TestHandlePromptsRender(t *testing.T) {
+	s := NewServer()
+	err := s.RegisterPrompt(Prompt{
+		Name:        "review",
+		Description: "Review a change",
+		Messages: []PromptMessage{
+			{Role: RoleSystem, Content: "You review {{.language}} code."},
+			{Role: RoleUser, Content: "Review this:\n{{.diff}}{{if .focus}}\nFocus on {{.focus}}.{{end}}"},
+		},
+		Arguments: []PromptArgument{
+			{Name: "diff", Required: true},
+			{Name: "language", Required: true},
+			{Name: "focus"},
+		},
+		Variables: map[string]interface{}{"language": "Go"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterPrompt() error = %v", err)
+	}
+	if err := s.RegisterPrompt(Prompt{Name: "broken", Template: "{{.unclosed"}); err == nil {
+		t.Error("RegisterPrompt() accepted a template that does not parse")
+	}
+
+	tests := []struct {
+		name     string
+		params   PromptRenderParams
+		want     []PromptMessage
+		wantCode int
+	}{
+		{
+			name:   "defaults and optional arguments",
+			params: PromptRenderParams{Name: "review", Arguments: map[string]interface{}{"diff": "+x"}},
+			want: []PromptMessage{
+				{Role: RoleSystem, Content: "You review Go code."},
+				{Role: RoleUser, Content: "Review this:\n+x"},
+			},
+		},
+		{
+			name:   "all arguments",
+			params: PromptRenderParams{Name: "review", Arguments: map[string]interface{}{"diff": "+x", "language": "Rust", "focus": "safety"}},
+			want: []PromptMessage{
+				{Role: RoleSystem, Content: "You review Rust code."},
+				{Role: RoleUser, Content: "Review this:\n+x\nFocus on safety."},
+			},
+		},
+		{
+			name:     "missing required argument",
+			params:   PromptRenderParams{Name: "review"},
+			wantCode: CodeInvalidParams,
+		},
+		{
+			name:     "unknown prompt",
+			params:   PromptRenderParams{Name: "missing"},
+			wantCode: CodePromptNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := json.Marshal(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := s.handlePromptsRender(context.Background(), &MCPMessage{ID: 1, Params: params})
+			if tt.wantCode != 0 {
+				var mcpErr *MCPError
+				if !errors.As(err, &mcpErr) || mcpErr.Code != tt.wantCode {
+					t.Fatalf("handlePromptsRender() error = %v, want code %d", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handlePromptsRender() error = %v", err)
+			}
+
+			var result PromptRenderResult
+			if err := json.Unmarshal(resp.Result, &result); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(result.Messages, tt.want) {
+				t.Errorf("handlePromptsRender() messages = %+v, want %+v", result.Messages, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientRequests(t *testing.T) {
+	s := NewServer()
+	if err := s.RegisterResource(Resource{URI: "memory://notes", Type: "memory", Name: "notes"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterPrompt(Prompt{Name: "greet", Template: "Hello, {{.name}}!", Arguments: []PromptArgument{{Name: "name"}}}); err != nil {
+		t.Fatal(err)
+	}
+	client := connect(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+
+	resources, err := client.ListResources(ctx)
+	if err != nil || len(resources) != 1 || resources[0].URI != "memory://notes" {
+		t.Fatalf("ListResources() = %v, %v, want memory://notes", resources, err)
+	}
+	if err := client.WriteResource(ctx, ResourceContents{URI: "memory://notes", Text: "remember"}); err != nil {
+		t.Fatalf("WriteResource() error = %v", err)
+	}
+	contents, err := client.ReadResource(ctx, "memory://notes")
+	if err != nil || contents.Text != "remember" {
+		t.Fatalf("ReadResource() = %+v, %v, want the written text", contents, err)
+	}
+	if _, err := client.ReadResource(ctx, "memory://missing"); !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("ReadResource(missing) error = %v, want %v", err, ErrResourceNotFound)
+	}
+
+	prompts, err := client.ListPrompts(ctx)
+	if err != nil || len(prompts) != 1 || prompts[0].Name != "greet" {
+		t.Fatalf("ListPrompts() = %v, %v, want greet", prompts, err)
+	}
+	rendered, err := client.RenderPrompt(ctx, "greet", map[string]interface{}{"name": "Ada"})
+	if err != nil {
+		t.Fatalf("RenderPrompt() error = %v", err)
+	}
+	want := []PromptMessage{{Role: RoleUser, Content: "Hello, Ada!"}}
+	if !slices.Equal(rendered.Messages, want) {
+		t.Errorf("RenderPrompt() messages = %+v, want %+v", rendered.Messages, want)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestKeepAlive(t *testing.T) {
+	// The server never answers pings
+	s := NewServer().Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+			if msg.Method == Ping {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return next(ctx, msg)
+		}
+	})
+
+	var logs syncBuffer
+	client, err := NewClientWithDialer(func() (Transport, error) {
+		serverSide, clientSide := pipeTransports()
+		go s.ServeTransport(serverSide)
+		return clientSide, nil
+	}, ClientConfig{KeepAlive: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.WithLogger(slog.NewTextHandler(&logs, nil))
+
+	waitFor(t, "the unanswered ping to close the connection", func() bool {
+		return client.State() != StateConnected
+	})
+	waitFor(t, "the closed connection to be logged", func() bool {
+		return strings.Contains(logs.String(), "did not answer ping")
+	})
+}
+
+func TestSampling(t *testing.T) {
+	s := NewServer()
+	err := s.RegisterTool(Tool{Name: "summarize"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		// A zero temperature is still sent
+		var temperature float32
+		result, err := SamplerFromContext(ctx).CreateMessage(ctx, CreateMessageParams{
+			Messages:      []SamplingMessage{{Role: RoleUser, Content: "Summarize the report"}},
+			MaxTokens:     100,
+			Temperature:   &temperature,
+			StopSequences: []string{"END"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result.Content, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		handler SamplingHandler
+		want    string
+		wantErr error
+	}{
+		{
+			name: "answered",
+			handler: func(ctx context.Context, params CreateMessageParams) (*CreateMessageResult, error) {
+				if params.Temperature == nil || *params.Temperature != 0 || !slices.Equal(params.StopSequences, []string{"END"}) {
+					return nil, fmt.Errorf("sampled at temperature %v with stop sequences %v", params.Temperature, params.StopSequences)
+				}
+				return &CreateMessageResult{Role: RoleAssistant, Content: "short: " + params.Messages[0].Content}, nil
+			},
+			want: `"short: Summarize the report"`,
+		},
+		{
+			name: "declined",
+			handler: func(ctx context.Context, params CreateMessageParams) (*CreateMessageResult, error) {
+				return nil, ErrRequestDeclined
+			},
+			wantErr: ErrRequestDeclined,
+		},
+		{
+			name:    "not supported",
+			wantErr: ErrServer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverSide, clientSide := pipeTransports()
+			go s.ServeTransport(serverSide)
+			client := NewClientWithTransport(clientSide, ClientCapabilities{})
+			defer client.Close()
+			if tt.handler != nil {
+				client.WithSampling(tt.handler)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := client.Initialize(ctx, ""); err != nil {
+				t.Fatalf("Initialize() error = %v", err)
+			}
+
+			result, err := client.CallTool(ctx, "summarize", nil)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("CallTool() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CallTool() error = %v", err)
+			}
+			if string(result) != tt.want {
+				t.Errorf("CallTool() = %s, want %s", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var local bytes.Buffer
+	s := NewServer().WithLogger(slog.NewTextHandler(&local, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	err := s.RegisterTool(Tool{Name: "work"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		logger := LoggerFromContext(ctx).With("tool", "work")
+		logger.Debug("starting")
+		logger.WithGroup("job").Info("processed", "items", 3, "err", errors.New("partial"))
+		logger.Warn("slow")
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := connect(t, s)
+
+	records := make(chan LogParams, 3)
+	client.OnLog(func(record LogParams) {
+		records <- record
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.SetLogLevel(ctx, slog.LevelInfo); err != nil {
+		t.Fatalf("SetLogLevel() error = %v", err)
+	}
+	if _, err := client.CallTool(ctx, "work", nil); err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+
+	var got []LogParams
+	for len(got) < 2 {
+		select {
+		case record := <-records:
+			got = append(got, record)
+		case <-ctx.Done():
+			t.Fatalf("received %d log records, want 2", len(got))
+		}
+	}
+
+	if got[0].Level != slog.LevelInfo || got[0].Message != "processed" {
+		t.Errorf("first record = %+v, want info processed", got[0])
+	}
+	wantAttrs := map[string]interface{}{"tool": "work", "job.items": float64(3), "job.err": "partial"}
+	for key, want := range wantAttrs {
+		if got[0].Attrs[key] != want {
+			t.Errorf("attribute %s = %v, want %v", key, got[0].Attrs[key], want)
+		}
+	}
+	if got[1].Level != slog.LevelWarn {
+		t.Errorf("second record level = %v, want %v", got[1].Level, slog.LevelWarn)
+	}
+
+	// The local handler keeps its own level
+	if out := local.String(); !strings.Contains(out, "slow") || strings.Contains(out, "processed") {
+		t.Errorf("local log = %q, want only the warning", out)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+				if msg.Method == "custom/echo" {
+					order = append(order, name)
+				}
+				return next(ctx, msg)
+			}
+		}
+	}
+	// Rewrites requests for a renamed method
+	rename := func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+			if msg.Method == "custom/echo" {
+				msg.Params = json.RawMessage(`{"text":"rewritten"}`)
+			}
+			return next(ctx, msg)
+		}
+	}
+
+	s := NewServer().Use(Recover(), trace("server first"), trace("server second"), rename)
+	s.RegisterHandler("custom/echo", func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+		return &MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: msg.Params}, nil
+	})
+	s.RegisterHandler("custom/panic", func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+		panic("boom")
+	})
+
+	client := connect(t, s)
+	client.Use(trace("client"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := client.Call(ctx, "custom/echo", map[string]string{"text": "original"})
+	if err != nil {
+		t.Fatalf("Call(custom/echo) error = %v", err)
+	}
+	if string(result) != `{"text":"rewritten"}` {
+		t.Errorf("Call(custom/echo) = %s, want the rewritten params", result)
+	}
+	wantOrder := []string{"client", "server first", "server second"}
+	if !slices.Equal(order, wantOrder) {
+		t.Errorf("middleware order = %v, want %v", order, wantOrder)
+	}
+
+	if _, err := client.Call(ctx, "custom/panic", nil); !errors.Is(err, ErrInternal) {
+		t.Errorf("Call(custom/panic) error = %v, want %v", err, ErrInternal)
+	}
+	if _, err := client.Call(ctx, "custom/missing", nil); !errors.Is(err, ErrMethodNotFound) {
+		t.Errorf("Call(custom/missing) error = %v, want %v", err, ErrMethodNotFound)
+	}
+}
+
+// recordingTransport records the frames written to a transport
+type recordingTransport struct {
+	Transport
+	mu     sync.Mutex
+	frames []string
+}
+
+func (t *recordingTransport) WriteMessage(data []byte) error {
+	t.mu.Lock()
+	t.frames = append(t.frames, string(data))
+	t.mu.Unlock()
+	return t.Transport.WriteMessage(data)
+}
+
+func TestBatch(t *testing.T) {
+	s := NewServer()
+	err := s.RegisterTool(Tool{Name: "echo"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		return arguments, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := NewMemoryProvider()
+	memory.Set(Resource{URI: "memory://notes"}, ResourceContents{Text: "remember"})
+	if err := s.RegisterResourceProvider("memory", memory); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("server", func(t *testing.T) {
+		serverSide, clientSide := pipeTransports()
+		go s.ServeTransport(serverSide)
+		defer clientSide.Close()
+
+		tests := []struct {
+			name    string
+			request string
+			want    []string // IDs and error codes of the responses, in order
+		}{
+			{
+				name:    "batch",
+				request: `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2,"method":"custom/missing"},1]`,
+				want:    []string{"1:0", "2:-32601", "null:-32600"},
+			},
+			{
+				name:    "empty batch",
+				request: `[]`,
+				want:    []string{"null:-32600"},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := clientSide.WriteMessage([]byte(tt.request)); err != nil {
+					t.Fatal(err)
+				}
+				data, err := clientSide.ReadMessage()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var responses []MCPMessage
+				if isBatch(data) {
+					err = json.Unmarshal(data, &responses)
+				} else {
+					responses = make([]MCPMessage, 1)
+					err = json.Unmarshal(data, &responses[0])
+				}
+				if err != nil {
+					t.Fatalf("error decoding %s: %v", data, err)
+				}
+
+				var got []string
+				for _, response := range responses {
+					code := 0
+					if response.Error != nil {
+						code = response.Error.Code
+					}
+					id, _ := json.Marshal(response.ID)
+					got = append(got, fmt.Sprintf("%s:%d", id, code))
+				}
+				slices.Sort(got)
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("responses = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("client", func(t *testing.T) {
+		serverSide, clientSide := pipeTransports()
+		go s.ServeTransport(serverSide)
+		recorder := &recordingTransport{Transport: clientSide}
+		client := NewClientWithTransport(recorder, ClientCapabilities{})
+		defer client.Close()
+
+		var intercepted atomic.Int32
+		client.Use(func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+				if msg.Method == ToolsCall {
+					intercepted.Add(1)
+				}
+				return next(ctx, msg)
+			}
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := client.Initialize(ctx, "file:///workspace"); err != nil {
+			t.Fatalf("Initialize() error = %v", err)
+		}
+
+		recorder.mu.Lock()
+		recorder.frames = nil
+		recorder.mu.Unlock()
+
+		results, err := client.Batch(ctx,
+			ToolCallRequest("echo", map[string]string{"text": "hi"}),
+			ReadResourceRequest("memory://notes"),
+			ToolCallRequest("missing", nil),
+		)
+		if err != nil {
+			t.Fatalf("Batch() error = %v", err)
+		}
+		if len(results) != 3 {
+			t.Fatalf("Batch() returned %d results, want 3", len(results))
+		}
+		if results[0].Err != nil || string(results[0].Result) != `{"text":"hi"}` {
+			t.Errorf("results[0] = %s, %v, want the echoed arguments", results[0].Result, results[0].Err)
+		}
+		if results[1].Err != nil || !strings.Contains(string(results[1].Result), "remember") {
+			t.Errorf("results[1] = %s, %v, want the resource contents", results[1].Result, results[1].Err)
+		}
+		if !errors.Is(results[2].Err, ErrToolNotFound) {
+			t.Errorf("results[2] error = %v, want %v", results[2].Err, ErrToolNotFound)
+		}
+		if n := intercepted.Load(); n != 2 {
+			t.Errorf("middleware saw %d tool calls, want 2", n)
+		}
+
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		if len(recorder.frames) != 1 || !isBatch([]byte(recorder.frames[0])) {
+			t.Errorf("Batch() wrote frames %q, want a single batch", recorder.frames)
+		}
+	})
+}
@@ -0,0 +1,456 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionIDHeader carries the SSE session a POSTed request belongs to
+const SessionIDHeader = "Mcp-Session-Id"
+
+// SessionIDParam is the query parameter naming the SSE session in the URL
+// sent in a stream's endpoint event, for clients that POST to that URL
+// rather than setting SessionIDHeader
+const SessionIDParam = "sessionId"
+
+const (
+	// maxSSERequestSize bounds the body of a POSTed JSON-RPC frame
+	maxSSERequestSize = 4 << 20
+	// sseKeepAlive is how often a comment is sent on idle event streams so
+	// proxies do not time them out
+	sseKeepAlive = 30 * time.Second
+)
+
+// errSessionClosed is returned when writing to a closed SSE session
+var errSessionClosed = errors.New("sse session closed")
+
+// sseSession is the server side of an HTTP+SSE connection. Requests arrive as
+// POST bodies and responses are written to the session's event stream.
+type sseSession struct {
+	id        string
+	incoming  chan []byte
+	outgoing  chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	onClose   func()
+
+	// principal is who opened the session, or who authenticated during
+	// initialize if it was opened without credentials. It is guarded by
+	// the server's lock.
+	principal *Principal
+	// openedWithCredentials requires the session's requests to carry the
+	// credentials it was opened with
+	openedWithCredentials bool
+}
+
+// ReadMessage implements Transport
+func (t *sseSession) ReadMessage() ([]byte, error) {
+	select {
+	case data := <-t.incoming:
+		return data, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+// WriteMessage implements Transport
+func (t *sseSession) WriteMessage(data []byte) error {
+	select {
+	case t.outgoing <- data:
+		return nil
+	case <-t.done:
+		return errSessionClosed
+	}
+}
+
+// Close implements Transport
+func (t *sseSession) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.onClose()
+	})
+	return nil
+}
+
+// newSessionID returns a random session identifier
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// serveSSE opens an event stream for a new session and serves MCP on it until
+// the client disconnects or the session is closed
+func (s *Server) serveSSE(w http.ResponseWriter, r *http.Request, principal *Principal) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		http.Error(w, "error creating session", http.StatusInternalServerError)
+		return
+	}
+
+	session := &sseSession{
+		id:                    id,
+		principal:             principal,
+		openedWithCredentials: principal != nil,
+		incoming:              make(chan []byte),
+		outgoing:              make(chan []byte, 64),
+		done:                  make(chan struct{}),
+	}
+	session.onClose = func() {
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	s.sessions[id] = session
+	s.mu.Unlock()
+	defer session.Close()
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set(SessionIDHeader, id)
+	w.WriteHeader(http.StatusOK)
+
+	endpoint := url.URL{Path: r.URL.Path, RawQuery: url.Values{SessionIDParam: {id}}.Encode()}
+	if err := writeSSEEvent(w, "endpoint", []byte(endpoint.String())); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	go func() {
+		if err := s.serveTransport(session, principal); err != nil {
+			s.log().Error("error serving sse session", "session", id, "err", err)
+		}
+	}()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case data := <-session.outgoing:
+			if err := writeSSEEvent(w, "message", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-session.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSEEvent writes data as a single server-sent event
+func writeSSEEvent(w io.Writer, event string, data []byte) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "event: %s\n", event)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// lookupSession returns the SSE session named by the request's session
+// header or query parameter. A session opened by an authenticated principal
+// is only found by requests with that principal's credentials, and one bound
+// to a principal during initialize by requests without credentials or with
+// that principal's.
+func (s *Server) lookupSession(r *http.Request, principal *Principal) (*sseSession, bool) {
+	id := r.Header.Get(SessionIDHeader)
+	if id == "" {
+		id = r.URL.Query().Get(SessionIDParam)
+	}
+	if id == "" {
+		return nil, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[id]
+	if !ok || session.principal == nil {
+		return session, ok
+	}
+	if principal == nil {
+		return session, !session.openedWithCredentials
+	}
+	return session, principal.ID == session.principal.ID
+}
+
+// handleSSEPost delivers a POSTed JSON-RPC frame to its session. The response
+// is sent on the session's event stream.
+func (s *Server) handleSSEPost(w http.ResponseWriter, r *http.Request, principal *Principal) {
+	session, ok := s.lookupSession(r, principal)
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSSERequestSize))
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case session.incoming <- data:
+		w.WriteHeader(http.StatusAccepted)
+	case <-session.done:
+		http.Error(w, "session closed", http.StatusNotFound)
+	case <-r.Context().Done():
+	}
+}
+
+// handleSSEDelete terminates a session at the client's request
+func (s *Server) handleSSEDelete(w http.ResponseWriter, r *http.Request, principal *Principal) {
+	session, ok := s.lookupSession(r, principal)
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	session.Close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sseClientTransport is the client side of an HTTP+SSE connection
+type sseClientTransport struct {
+	url       string
+	sessionID string
+	header    http.Header
+	client    *http.Client
+	events    chan []byte
+	done      chan struct{}
+	stopped   chan struct{}
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	err       error
+
+	// closeTimeout bounds the DELETE that ends the session
+	closeTimeout time.Duration
+}
+
+// sseCloseTimeout bounds how long Close waits for the server to end the
+// session, since the client used for SSE has no timeout of its own
+const sseCloseTimeout = 5 * time.Second
+
+// DialSSE opens an event stream to an MCP server over HTTP and returns a
+// transport that POSTs requests to the same URL. The header is sent with
+// every request.
+func DialSSE(url string, header http.Header) (Transport, error) {
+	// The event stream is long lived, so it must not share a client timeout
+	return dialSSE(url, header, &http.Client{})
+}
+
+// dialSSE opens an SSE transport using client for all requests
+func dialSSE(url string, header http.Header, client *http.Client) (Transport, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("error opening event stream: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("event stream request failed with status %d", resp.StatusCode)
+	}
+
+	sessionID := resp.Header.Get(SessionIDHeader)
+	if sessionID == "" {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("server did not assign a session id")
+	}
+
+	t := &sseClientTransport{
+		url:       url,
+		sessionID: sessionID,
+		header:    header,
+		client:    client,
+		events:    make(chan []byte, 64),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		cancel:    cancel,
+
+		closeTimeout: sseCloseTimeout,
+	}
+	go t.readEvents(resp.Body)
+
+	return t, nil
+}
+
+// readEvents parses the event stream and queues message payloads
+func (t *sseClientTransport) readEvents(body io.ReadCloser) {
+	defer body.Close()
+	defer close(t.done)
+
+	reader := bufio.NewReader(body)
+	var event string
+	var data bytes.Buffer
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				err = io.EOF
+			}
+			t.err = err
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if data.Len() > 0 && (event == "" || event == "message") {
+				select {
+				case t.events <- bytes.Clone(data.Bytes()):
+				case <-t.stopped:
+					t.err = io.EOF
+					return
+				}
+			}
+			event = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// Comment, used for keepalives
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+// ReadMessage implements Transport
+func (t *sseClientTransport) ReadMessage() ([]byte, error) {
+	select {
+	case data := <-t.events:
+		return data, nil
+	case <-t.done:
+		// Drain events that arrived before the stream ended
+		select {
+		case data := <-t.events:
+			return data, nil
+		default:
+			return nil, t.err
+		}
+	}
+}
+
+// WriteMessage implements Transport
+func (t *sseClientTransport) WriteMessage(data []byte) error {
+	resp, err := t.do(context.Background(), http.MethodPost, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Close ends the session on the server and closes the event stream
+func (t *sseClientTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), t.closeTimeout)
+		defer cancel()
+
+		var resp *http.Response
+		resp, err = t.do(ctx, http.MethodDelete, nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		close(t.stopped)
+		t.cancel()
+	})
+	return err
+}
+
+// do sends a request for the transport's session
+func (t *sseClientTransport) do(ctx context.Context, method string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	for key, values := range t.header {
+		req.Header[key] = values
+	}
+	req.Header.Set(SessionIDHeader, t.sessionID)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	return resp, nil
+}
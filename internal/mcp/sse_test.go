@@ -0,0 +1,273 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newHTTPServer serves s over HTTP for the duration of the test
+func newHTTPServer(t *testing.T, s *Server) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		// Event streams would otherwise keep Close waiting
+		ts.CloseClientConnections()
+		ts.Close()
+	})
+	return ts
+}
+
+// sseStream is an event stream opened with a raw GET
+type sseStream struct {
+	resp   *http.Response
+	reader *bufio.Reader
+}
+
+// openSSEStream opens an event stream that ends when ctx is done
+func openSSEStream(t *testing.T, ctx context.Context, url string) *sseStream {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	return &sseStream{resp: resp, reader: bufio.NewReader(resp.Body)}
+}
+
+// next reads the next event from the stream
+func (s *sseStream) next() (event, data string, err error) {
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return "", "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "" && event != "":
+			return event, data, nil
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// sessionCount returns the number of open SSE sessions and connected clients
+func sessionCount(s *Server) (sessions, clients int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sessions), len(s.clients)
+}
+
+// waitFor fails the test unless cond becomes true within a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// post sends a request for the session named by header or in url
+func post(t *testing.T, method, url, sessionID, body string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessionID != "" {
+		req.Header.Set(SessionIDHeader, sessionID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSSEHandshake(t *testing.T) {
+	ts := newHTTPServer(t, NewServer())
+
+	resp, err := http.Get(ts.URL + DefaultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("GET without Accept status = %d, want %d", resp.StatusCode, http.StatusNotAcceptable)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream := openSSEStream(t, ctx, ts.URL+DefaultPath)
+
+	if got := stream.resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", got)
+	}
+	id := stream.resp.Header.Get(SessionIDHeader)
+	if id == "" {
+		t.Fatal("no session id in response header")
+	}
+	event, data, err := stream.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := DefaultPath + "?" + SessionIDParam + "=" + id; event != "endpoint" || data != want {
+		t.Errorf("first event = %s %q, want endpoint %q", event, data, want)
+	}
+
+	// Requests POSTed to the endpoint are answered on the stream
+	if status := post(t, http.MethodPost, ts.URL+data, "", `{"jsonrpc":"2.0","id":7,"method":"ping"}`); status != http.StatusAccepted {
+		t.Fatalf("POST status = %d, want %d", status, http.StatusAccepted)
+	}
+	event, data, err = stream.next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response MCPMessage
+	if err := json.Unmarshal([]byte(data), &response); err != nil {
+		t.Fatalf("error decoding %s event %q: %v", event, data, err)
+	}
+	if event != "message" || idKey(response.ID) != "7" || response.Error != nil {
+		t.Errorf("response = %s %q, want the ping result", event, data)
+	}
+}
+
+func TestSSESessions(t *testing.T) {
+	s := NewServer()
+	err := s.RegisterTool(Tool{Name: "echo"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		return arguments, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newHTTPServer(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transport, err := DialSSE(ts.URL+DefaultPath, nil)
+	if err != nil {
+		t.Fatalf("DialSSE() error = %v", err)
+	}
+	client := NewClientWithTransport(transport, ClientCapabilities{})
+	if _, err := client.Initialize(ctx, ""); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	result, err := client.CallTool(ctx, "echo", map[string]string{"text": "hi"})
+	if err != nil || string(result) != `{"text":"hi"}` {
+		t.Fatalf("CallTool() = %s, %v, want the echoed arguments", result, err)
+	}
+
+	id := transport.(*sseClientTransport).sessionID
+	tests := []struct {
+		name      string
+		method    string
+		sessionID string
+		want      int
+	}{
+		{name: "no session", method: http.MethodPost, want: http.StatusNotFound},
+		{name: "unknown session", method: http.MethodPost, sessionID: "unknown", want: http.StatusNotFound},
+		{name: "delete unknown session", method: http.MethodDelete, sessionID: "unknown", want: http.StatusNotFound},
+		{name: "delete", method: http.MethodDelete, sessionID: id, want: http.StatusNoContent},
+		{name: "closed session", method: http.MethodPost, sessionID: id, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := post(t, tt.method, ts.URL+DefaultPath, tt.sessionID, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+			if status != tt.want {
+				t.Errorf("%s status = %d, want %d", tt.method, status, tt.want)
+			}
+		})
+	}
+
+	// Deleting the session ends the stream and the client's connection
+	waitFor(t, "the session to be torn down", func() bool {
+		sessions, clients := sessionCount(s)
+		return sessions == 0 && clients == 0
+	})
+	if _, err := transport.ReadMessage(); err == nil {
+		t.Error("ReadMessage() after DELETE succeeded, want the stream closed")
+	}
+	client.Close()
+}
+
+func TestSSEClientDisconnect(t *testing.T) {
+	s := NewServer()
+	ts := newHTTPServer(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := openSSEStream(t, ctx, ts.URL+DefaultPath)
+	if _, _, err := stream.next(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the session to be served", func() bool {
+		sessions, clients := sessionCount(s)
+		return sessions == 1 && clients == 1
+	})
+
+	cancel()
+	waitFor(t, "the session to be cleaned up", func() bool {
+		sessions, clients := sessionCount(s)
+		return sessions == 0 && clients == 0
+	})
+	id := stream.resp.Header.Get(SessionIDHeader)
+	if status := post(t, http.MethodPost, ts.URL+DefaultPath, id, `{"jsonrpc":"2.0","id":1,"method":"ping"}`); status != http.StatusNotFound {
+		t.Errorf("POST after disconnect status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestSSECloseUnresponsiveServer(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set(SessionIDHeader, "stuck")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		// Never answer the DELETE, nor end the stream
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { close(release) })
+
+	transport, err := DialSSE(ts.URL, nil)
+	if err != nil {
+		t.Fatalf("DialSSE() error = %v", err)
+	}
+	transport.(*sseClientTransport).closeTimeout = 50 * time.Millisecond
+
+	closed := make(chan error, 1)
+	go func() { closed <- transport.Close() }()
+	select {
+	case err := <-closed:
+		if err == nil {
+			t.Error("Close() with an unresponsive server succeeded, want error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() blocked on an unresponsive server")
+	}
+}
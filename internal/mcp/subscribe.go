@@ -0,0 +1,386 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// ResourceWatcher is implemented by providers that can report changes to
+// their resources
+type ResourceWatcher interface {
+	// Watch reports changes until ctx is done. Updated is called with the URI
+	// of each resource that was modified, created or removed, and listChanged
+	// when resources were created or removed.
+	Watch(ctx context.Context, updated func(uri string), listChanged func()) error
+}
+
+// ResourceUpdatedFunc receives the URI of a subscribed resource that changed
+type ResourceUpdatedFunc func(uri string)
+
+// resourceParams are the parameters of requests naming a single resource
+type resourceParams struct {
+	URI string `json:"uri"`
+}
+
+// watch runs a provider's watcher until ctx is done
+func (s *Server) watch(ctx context.Context, resourceType string, watcher ResourceWatcher) {
+	listChanged := func() { s.notifyListChanged(ResourcesListChanged) }
+	updated := func(uri string) {
+		if err := s.NotifyResourceUpdated(uri); err != nil {
+			s.log().Error("error sending notification", "type", ResourceUpdated, "err", err)
+		}
+	}
+
+	go func() {
+		err := watcher.Watch(withLogger(ctx, s.log()), updated, listChanged)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			s.log().Error("error watching resources", "type", resourceType, "err", err)
+		}
+	}()
+}
+
+// NotifyResourceUpdated tells the clients subscribed to uri that it changed.
+// It attempts every subscriber and returns the errors joined.
+func (s *Server) NotifyResourceUpdated(uri string) error {
+	s.mu.RLock()
+	var clients []*ClientState
+	for _, client := range s.clients {
+		if client.Initialized && client.subscriptions[uri] {
+			clients = append(clients, client)
+		}
+	}
+	s.mu.RUnlock()
+
+	var errs []error
+	for _, client := range clients {
+		err := s.Notify(client, NotificationParams{
+			Type:    ResourceUpdated,
+			Message: uri,
+			Data:    resourceParams{URI: uri},
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) handleResourcesSubscribe(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	var params resourceParams
+	if err := sonic.Unmarshal(msg.Params, &params); err != nil || params.URI == "" {
+		return nil, NewError(CodeInvalidParams, "invalid resource subscribe params", nil)
+	}
+
+	if policy, principal := s.access(msg); !policy.AllowResource(principal, params.URI, ReadAccess) {
+		return nil, forbidden("resource", params.URI)
+	}
+
+	// The resource need not exist yet; a file may be created later
+	s.mu.Lock()
+	if client, ok := s.clients[msg.Conn]; ok {
+		client.subscriptions[params.URI] = true
+	}
+	s.mu.Unlock()
+
+	return &MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: []byte(`{}`)}, nil
+}
+
+func (s *Server) handleResourcesUnsubscribe(ctx context.Context, msg *MCPMessage) (*MCPMessage, error) {
+	var params resourceParams
+	if err := sonic.Unmarshal(msg.Params, &params); err != nil || params.URI == "" {
+		return nil, NewError(CodeInvalidParams, "invalid resource unsubscribe params", nil)
+	}
+
+	s.mu.Lock()
+	if client, ok := s.clients[msg.Conn]; ok {
+		delete(client.subscriptions, params.URI)
+	}
+	s.mu.Unlock()
+
+	return &MCPMessage{JSONRPC: "2.0", ID: msg.ID, Result: []byte(`{}`)}, nil
+}
+
+// memoryWatcher holds the callbacks of one MemoryProvider watch
+type memoryWatcher struct {
+	updated     func(uri string)
+	listChanged func()
+}
+
+// Watch implements ResourceWatcher. Changes made with Set and Delete are
+// reported; writes arrive through resources/write, which notifies
+// subscribers itself.
+func (p *MemoryProvider) Watch(ctx context.Context, updated func(uri string), listChanged func()) error {
+	w := &memoryWatcher{updated: updated, listChanged: listChanged}
+
+	p.mu.Lock()
+	p.watchers = append(p.watchers, w)
+	p.mu.Unlock()
+
+	<-ctx.Done()
+
+	p.mu.Lock()
+	for i, existing := range p.watchers {
+		if existing == w {
+			p.watchers = append(p.watchers[:i], p.watchers[i+1:]...)
+			break
+		}
+	}
+	p.mu.Unlock()
+	return ctx.Err()
+}
+
+// notify reports a change to every watcher. The caller must not hold p.mu.
+func (p *MemoryProvider) notify(uri string, listChanged bool) {
+	p.mu.RLock()
+	watchers := append([]*memoryWatcher(nil), p.watchers...)
+	p.mu.RUnlock()
+
+	for _, w := range watchers {
+		w.updated(uri)
+		if listChanged {
+			w.listChanged()
+		}
+	}
+}
+
+// DefaultPollInterval is how often a FileProvider checks its files for
+// changes unless overridden with WithPollInterval
+const DefaultPollInterval = 2 * time.Second
+
+// fileState is what a FileProvider compares to detect a changed file
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// WithPollInterval sets how often Watch checks the files for changes
+func (p *FileProvider) WithPollInterval(interval time.Duration) *FileProvider {
+	p.pollInterval = interval
+	return p
+}
+
+// Watch implements ResourceWatcher by polling the directory tree. A file
+// is reported once it is unchanged across two scans, so a write seen part
+// way through produces a single update when it completes.
+func (p *FileProvider) Watch(ctx context.Context, updated func(uri string), listChanged func()) error {
+	interval := p.pollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	scanned, err := p.scan()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.snapshot = maps.Clone(scanned)
+	p.mu.Unlock()
+	if p.afterScan != nil {
+		p.afterScan()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		current, err := p.scan()
+		if err != nil {
+			LoggerFromContext(ctx).Error("error scanning files", "root", p.root, "err", err)
+			continue
+		}
+
+		var changed []string
+		created, removed := false, false
+		p.mu.Lock()
+		for path, state := range current {
+			if previous, ok := scanned[path]; !ok || previous != state {
+				// Still being written
+				continue
+			}
+			reported, existed := p.snapshot[path]
+			if existed && reported == state {
+				continue
+			}
+			created = created || !existed
+			p.snapshot[path] = state
+			changed = append(changed, path)
+		}
+		for path := range p.snapshot {
+			_, exists := current[path]
+			_, existed := scanned[path]
+			if !exists && !existed {
+				delete(p.snapshot, path)
+				removed = true
+				changed = append(changed, path)
+			}
+		}
+		p.mu.Unlock()
+		scanned = current
+		if p.afterScan != nil {
+			p.afterScan()
+		}
+
+		for _, path := range changed {
+			updated(fileURI(path))
+		}
+		if created || removed {
+			listChanged()
+		}
+	}
+}
+
+// scan records the state of every regular file under the root
+func (p *FileProvider) scan() (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(p.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// Removed since it was listed
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	return files, err
+}
+
+// recordWrite updates the watch snapshot after a write through
+// resources/write, which notifies subscribers itself
+func (p *FileProvider) recordWrite(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.snapshot != nil {
+		p.snapshot[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+}
+
+// Subscribe asks the server to report changes to the resource at uri and
+// calls fn, on its own goroutine, for each one. Subscriptions are renewed
+// after the client reconnects.
+func (c *Client) Subscribe(ctx context.Context, uri string, fn ResourceUpdatedFunc) error {
+	if err := c.requireCapability(ResourcesSubscribe); err != nil {
+		return err
+	}
+
+	params, err := sonic.Marshal(resourceParams{URI: uri})
+	if err != nil {
+		return fmt.Errorf("error marshaling params: %w", err)
+	}
+
+	c.mu.Lock()
+	c.subscriptions[uri] = fn
+	c.mu.Unlock()
+
+	if _, err := c.sendRequest(ctx, ResourcesSubscribe, params); err != nil {
+		c.mu.Lock()
+		delete(c.subscriptions, uri)
+		c.mu.Unlock()
+		return fmt.Errorf("resources/subscribe request failed: %w", err)
+	}
+	return nil
+}
+
+// Unsubscribe stops change reports for the resource at uri
+func (c *Client) Unsubscribe(ctx context.Context, uri string) error {
+	if err := c.requireCapability(ResourcesUnsubscribe); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	delete(c.subscriptions, uri)
+	c.mu.Unlock()
+
+	params, err := sonic.Marshal(resourceParams{URI: uri})
+	if err != nil {
+		return fmt.Errorf("error marshaling params: %w", err)
+	}
+	if _, err := c.sendRequest(ctx, ResourcesUnsubscribe, params); err != nil {
+		return fmt.Errorf("resources/unsubscribe request failed: %w", err)
+	}
+	return nil
+}
+
+// resubscribe renews every subscription on a new connection
+func (c *Client) resubscribe(ctx context.Context) error {
+	c.mu.RLock()
+	uris := make([]string, 0, len(c.subscriptions))
+	for uri := range c.subscriptions {
+		uris = append(uris, uri)
+	}
+	c.mu.RUnlock()
+
+	for _, uri := range uris {
+		params, err := sonic.Marshal(resourceParams{URI: uri})
+		if err != nil {
+			return fmt.Errorf("error marshaling params: %w", err)
+		}
+		if _, err := c.sendRequest(ctx, ResourcesSubscribe, params); err != nil {
+			return fmt.Errorf("error renewing subscription to %s: %w", uri, err)
+		}
+	}
+	return nil
+}
+
+// resourceUpdated delivers an updated notification to its subscriber
+func (c *Client) resourceUpdated(data []byte) {
+	var params resourceParams
+	if err := sonic.Unmarshal(data, &params); err != nil {
+		return
+	}
+
+	c.mu.RLock()
+	fn, ok := c.subscriptions[params.URI]
+	c.mu.RUnlock()
+
+	// The callback may read the resource, which needs the read loop
+	if ok {
+		go fn(params.URI)
+	}
+}
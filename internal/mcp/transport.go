@@ -0,0 +1,224 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries JSON-RPC frames between an MCP client and server
+type Transport interface {
+	// ReadMessage blocks until the next frame is received. It returns io.EOF
+	// once the peer has closed the transport cleanly.
+	ReadMessage() ([]byte, error)
+	// WriteMessage sends a single frame. It must be safe for concurrent use.
+	WriteMessage(data []byte) error
+	// Close closes the transport, unblocking any pending ReadMessage
+	Close() error
+}
+
+// writeJSON marshals v and writes it to t as a single frame
+func writeJSON(t Transport, v interface{}) error {
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error marshaling message: %w", err)
+	}
+	return t.WriteMessage(data)
+}
+
+// idKey normalizes a JSON-RPC ID for use as a map key, since IDs decoded from
+// the wire are float64 or string regardless of the type they were sent with
+func idKey(id interface{}) string {
+	key, err := sonic.Marshal(id)
+	if err != nil {
+		return fmt.Sprint(id)
+	}
+	return string(key)
+}
+
+// WebSocketTransport is a Transport over a WebSocket connection, with one
+// JSON-RPC frame per text message
+type WebSocketTransport struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+// NewWebSocketTransport creates a transport on an established WebSocket connection
+func NewWebSocketTransport(conn *websocket.Conn) *WebSocketTransport {
+	return &WebSocketTransport{conn: conn}
+}
+
+// ReadMessage implements Transport
+func (t *WebSocketTransport) ReadMessage() ([]byte, error) {
+	_, data, err := t.conn.ReadMessage()
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		return nil, io.EOF
+	}
+	return data, err
+}
+
+// WriteMessage implements Transport
+func (t *WebSocketTransport) WriteMessage(data []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Close sends a normal closure frame and closes the connection
+func (t *WebSocketTransport) Close() error {
+	deadline := time.Now().Add(time.Second)
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	// WriteControl may be called concurrently with WriteMessage
+	_ = t.conn.WriteControl(websocket.CloseMessage, msg, deadline)
+	return t.conn.Close()
+}
+
+// StdioTransport is a Transport over a pair of byte streams carrying
+// newline-delimited JSON-RPC frames, as used by MCP servers launched as
+// subprocesses
+type StdioTransport struct {
+	reader  *bufio.Reader
+	writer  io.Writer
+	closers []io.Closer
+	writeMu sync.Mutex
+}
+
+// NewStdioTransport creates a transport reading frames from r and writing
+// them to w. If r or w implement io.Closer they are closed by Close.
+func NewStdioTransport(r io.Reader, w io.Writer) *StdioTransport {
+	t := &StdioTransport{
+		reader: bufio.NewReader(r),
+		writer: w,
+	}
+	for _, stream := range []interface{}{r, w} {
+		if closer, ok := stream.(io.Closer); ok {
+			t.closers = append(t.closers, closer)
+		}
+	}
+	return t
+}
+
+// ReadMessage implements Transport
+func (t *StdioTransport) ReadMessage() ([]byte, error) {
+	for {
+		line, err := t.reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// WriteMessage implements Transport
+func (t *StdioTransport) WriteMessage(data []byte) error {
+	if bytes.IndexByte(data, '\n') >= 0 {
+		return fmt.Errorf("stdio frames must not contain newlines")
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	frame := make([]byte, 0, len(data)+1)
+	frame = append(frame, data...)
+	frame = append(frame, '\n')
+	_, err := t.writer.Write(frame)
+	return err
+}
+
+// Close implements Transport
+func (t *StdioTransport) Close() error {
+	var errs []error
+	for _, closer := range t.closers {
+		if err := closer.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// commandTransport is a StdioTransport connected to a child process
+type commandTransport struct {
+	*StdioTransport
+	cmd *exec.Cmd
+}
+
+// NewCommandTransport starts cmd and returns a transport speaking to it over
+// its stdin and stdout. The process's stderr is passed through unless cmd
+// already has one set. Closing the transport closes the child's stdin and
+// waits briefly for it to exit before killing it.
+func NewCommandTransport(cmd *exec.Cmd) (Transport, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating stdout pipe: %w", err)
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting %s: %w", cmd.Path, err)
+	}
+
+	return &commandTransport{
+		StdioTransport: NewStdioTransport(stdout, stdin),
+		cmd:            cmd,
+	}, nil
+}
+
+// Close implements Transport
+func (t *commandTransport) Close() error {
+	closeErr := t.StdioTransport.Close()
+
+	// Wait is only called here because it closes stdout once the process
+	// exits, which would drop frames that have not been read yet
+	done := make(chan error, 1)
+	go func() {
+		done <- t.cmd.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		if err := t.cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("error killing %s: %w", t.cmd.Path, err)
+		}
+		<-done
+	}
+
+	return closeErr
+}
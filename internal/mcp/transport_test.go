@@ -0,0 +1,162 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// pipeTransports returns a connected pair of stdio transports
+func pipeTransports() (Transport, Transport) {
+	serverRead, clientWrite := io.Pipe()
+	clientRead, serverWrite := io.Pipe()
+	return NewStdioTransport(serverRead, serverWrite), NewStdioTransport(clientRead, clientWrite)
+}
+
+// connect serves s on one end of a pipe and returns an initialized client on
+// the other
+func connect(t *testing.T, s *Server) *Client {
+	t.Helper()
+
+	serverSide, clientSide := pipeTransports()
+	go s.ServeTransport(serverSide)
+	client := NewClientWithTransport(clientSide, ClientCapabilities{})
+	t.Cleanup(func() { client.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Initialize(ctx, "file:///workspace"); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	return client
+}
+
+func TestStdioTransportRoundTrip(t *testing.T) {
+	type echoArgs struct {
+		Text string `json:"text"`
+	}
+
+	s := NewServer()
+	err := s.RegisterTool(Tool{Name: "echo"}, TypedToolHandler(func(ctx context.Context, args echoArgs) (interface{}, error) {
+		return args.Text, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverSide, clientSide := pipeTransports()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ServeTransport(serverSide)
+	}()
+
+	client := NewClientWithTransport(clientSide, ClientCapabilities{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.Initialize(ctx, ""); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	result, err := client.CallTool(ctx, "echo", echoArgs{Text: "hello"})
+	if err != nil {
+		t.Fatalf("CallTool() error = %v", err)
+	}
+	if string(result) != `"hello"` {
+		t.Errorf("CallTool() = %s, want %q", result, `"hello"`)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeTransport() error = %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("ServeTransport did not return after client closed")
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	s := NewServer()
+	started := make(chan struct{}, 1)
+	err := s.RegisterTool(Tool{Name: "wait"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.RegisterTool(Tool{Name: "ping"}, func(ctx context.Context, arguments json.RawMessage) (interface{}, error) {
+		return "pong", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverSides := make(chan Transport, 4)
+	dial := func() (Transport, error) {
+		serverSide, clientSide := pipeTransports()
+		go s.ServeTransport(serverSide)
+		serverSides <- serverSide
+		return clientSide, nil
+	}
+
+	client, err := NewClientWithDialer(dial, ClientConfig{
+		Reconnect: &ReconnectConfig{InitialWait: 10 * time.Millisecond, Multiplier: 2},
+	})
+	if err != nil {
+		t.Fatalf("NewClientWithDialer() error = %v", err)
+	}
+	defer client.Close()
+
+	states := make(chan ConnectionState, 4)
+	client.OnStateChange(func(state ConnectionState, err error) {
+		states <- state
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.Initialize(ctx, ""); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	pending := make(chan error, 1)
+	go func() {
+		_, err := client.CallTool(ctx, "wait", nil)
+		pending <- err
+	}()
+	<-started
+
+	// Drop the connection from the server side
+	(<-serverSides).Close()
+
+	var disconnectErr *DisconnectError
+	if err := <-pending; !errors.As(err, &disconnectErr) {
+		t.Fatalf("pending CallTool() error = %v, want *DisconnectError", err)
+	}
+
+	for _, want := range []ConnectionState{StateReconnecting, StateConnected} {
+		select {
+		case state := <-states:
+			if state != want {
+				t.Fatalf("state = %v, want %v", state, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("state %v not reported", want)
+		}
+	}
+
+	result, err := client.CallTool(ctx, "ping", nil)
+	if err != nil {
+		t.Fatalf("CallTool() after reconnect error = %v", err)
+	}
+	if string(result) != `"pong"` {
+		t.Errorf("CallTool() after reconnect = %s, want %q", result, `"pong"`)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2025 Gavin Volpe
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gavinvolpe/nexus/pkg/types"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// SchemaFor derives a JSON Schema from the Go type T. Struct fields are named
+// by their json tags and may carry these tags:
+//
+//	description:"..."  documents the field
+//	enum:"a,b,c"       restricts the field to the listed values
+//	required:"true"    marks the field required; required:"false" optional
+//
+// Without a required tag, a field is required unless it is a pointer or its
+// json tag has omitempty. Pointer, slice and map fields, elements and values
+// also accept null, since that is how encoding/json writes them when nil.
+func SchemaFor[T any]() map[string]interface{} {
+	return schemaForType(reflect.TypeOf((*T)(nil)).Elem(), make(map[reflect.Type]bool))
+}
+
+// schemaForType builds the schema for t. Seen holds the struct types being
+// expanded, so recursive types end in an unconstrained schema.
+func schemaForType(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as base64 strings
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": allowNull(t.Elem(), schemaForType(t.Elem(), seen))}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": allowNull(t.Elem(), schemaForType(t.Elem(), seen))}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]interface{}{}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		schema := map[string]interface{}{"type": "object"}
+		properties := make(map[string]interface{})
+		var required []string
+		addStructFields(t, properties, &required, seen)
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		// interface{} and anything else JSON can hold
+		return map[string]interface{}{}
+	}
+}
+
+// addStructFields adds the schemas of t's exported fields to properties,
+// flattening embedded structs the way encoding/json does
+func addStructFields(t reflect.Type, properties map[string]interface{}, required *[]string, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addStructFields(embedded, properties, required, seen)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := schemaForType(field.Type, seen)
+		if description := field.Tag.Get("description"); description != "" {
+			schema["description"] = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = enumValues(enum, schema["type"])
+		}
+		properties[name] = allowNull(field.Type, schema)
+
+		optional := field.Type.Kind() == reflect.Pointer || strings.Contains(","+opts+",", ",omitempty,")
+		switch field.Tag.Get("required") {
+		case "true":
+			optional = false
+		case "false":
+			optional = true
+		}
+		if !optional {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// allowNull widens schema to accept null when t encodes as null in its zero
+// value. It returns schema for convenience.
+func allowNull(t reflect.Type, schema map[string]interface{}) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+	default:
+		return schema
+	}
+	if schemaType, ok := schema["type"].(string); ok {
+		schema["type"] = []string{schemaType, "null"}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		schema["enum"] = append(enum, nil)
+	}
+	return schema
+}
+
+// enumValues parses a comma-separated enum tag into values of the field's
+// schema type
+func enumValues(tag string, schemaType interface{}) []interface{} {
+	parts := strings.Split(tag, ",")
+	values := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		switch schemaType {
+		case "integer", "number":
+			if n, err := strconv.ParseFloat(part, 64); err == nil {
+				values = append(values, n)
+				continue
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(part); err == nil {
+				values = append(values, b)
+				continue
+			}
+		}
+		values = append(values, part)
+	}
+	return values
+}
+
+// FuncTool is a tool definition and handler derived from a typed Go function
+type FuncTool struct {
+	Tool    Tool
+	Handler ToolHandler
+}
+
+// NewFuncTool derives a tool from fn. The parameters schema comes from Args
+// and the returns schema from Result, unless Result is an interface type.
+func NewFuncTool[Args, Result any](name, description string, fn func(ctx context.Context, args Args) (Result, error)) FuncTool {
+	tool := Tool{
+		Name:        name,
+		Description: description,
+		Parameters:  SchemaFor[Args](),
+	}
+	if reflect.TypeOf((*Result)(nil)).Elem().Kind() != reflect.Interface {
+		tool.Returns = SchemaFor[Result]()
+	}
+
+	return FuncTool{
+		Tool: tool,
+		Handler: TypedToolHandler(func(ctx context.Context, args Args) (interface{}, error) {
+			return fn(ctx, args)
+		}),
+	}
+}
+
+// TypesTool returns the definition as a types.Tool, for registering the same
+// tool with a model
+func (f FuncTool) TypesTool() *types.Tool {
+	parameters, _ := f.Tool.Parameters.(map[string]interface{})
+	return &types.Tool{
+		Name:        f.Tool.Name,
+		Description: f.Tool.Description,
+		Parameters:  parameters,
+	}
+}
+
+// RegisterFunc derives a tool from fn with NewFuncTool and registers it on s
+func RegisterFunc[Args, Result any](s *Server, name, description string, fn func(ctx context.Context, args Args) (Result, error)) error {
+	f := NewFuncTool(name, description, fn)
+	return s.RegisterTool(f.Tool, f.Handler)
+}
@@ -22,36 +22,49 @@ package mcp
 import (
 	"encoding/json"
 	"time"
-
-	"github.com/gorilla/websocket"
 )
 
+// ProtocolVersion is the latest MCP protocol revision implemented by this package
+const ProtocolVersion = "2024-11-05"
+
+// supportedProtocolVersions lists the protocol revisions this package can speak
+var supportedProtocolVersions = []string{ProtocolVersion}
+
 // MCPMethod represents the method type for MCP requests
 type MCPMethod string
 
 const (
-	Initialize     MCPMethod = "initialize"
-	Initialized    MCPMethod = "initialized"
-	ToolsList      MCPMethod = "tools/list"
-	ToolsCall      MCPMethod = "tools/call"
-	ResourcesList  MCPMethod = "resources/list"
-	ResourcesRead  MCPMethod = "resources/read"
-	ResourcesWrite MCPMethod = "resources/write"
-	PromptsRender  MCPMethod = "prompts/render"
-	PromptsList    MCPMethod = "prompts/list"
-	Notification   MCPMethod = "$/notification"
-	CancelRequest  MCPMethod = "$/cancelRequest"
+	Initialize             MCPMethod = "initialize"
+	Initialized            MCPMethod = "initialized"
+	ToolsList              MCPMethod = "tools/list"
+	ToolsCall              MCPMethod = "tools/call"
+	ResourcesList          MCPMethod = "resources/list"
+	ResourcesRead          MCPMethod = "resources/read"
+	ResourcesWrite         MCPMethod = "resources/write"
+	ResourcesTemplatesList MCPMethod = "resources/templates/list"
+	ResourcesSubscribe     MCPMethod = "resources/subscribe"
+	ResourcesUnsubscribe   MCPMethod = "resources/unsubscribe"
+	PromptsRender          MCPMethod = "prompts/render"
+	PromptsList            MCPMethod = "prompts/list"
+	Notification           MCPMethod = "$/notification"
+	CancelRequest          MCPMethod = "$/cancelRequest"
+	Ping                   MCPMethod = "ping"
+	LoggingSetLevel        MCPMethod = "logging/setLevel"
+
+	// Methods sent from the server to the client
+	RootsList             MCPMethod = "roots/list"
+	SamplingCreateMessage MCPMethod = "sampling/createMessage"
 )
 
 // MCPMessage represents the base message structure for MCP
 type MCPMessage struct {
 	JSONRPC string          `json:"jsonrpc"`
 	ID      interface{}     `json:"id,omitempty"`
-	Method  MCPMethod       `json:"method"`
+	Method  MCPMethod       `json:"method,omitempty"`
 	Params  json.RawMessage `json:"params,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   *MCPError       `json:"error,omitempty"`
-	Conn    *websocket.Conn `json:"-"`
+	Conn    Transport       `json:"-"`
 }
 
 // MCPError represents an error in MCP
@@ -61,10 +74,37 @@ type MCPError struct {
 	Data    any    `json:"data,omitempty"`
 }
 
+// Error implements the error interface
+func (e *MCPError) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is an MCPError with the same code
+func (e *MCPError) Is(target error) bool {
+	t, ok := target.(*MCPError)
+	return ok && t.Code == e.Code
+}
+
+// Implementation identifies an MCP client or server implementation
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
 // InitializeParams represents the parameters for initialize request
 type InitializeParams struct {
-	RootURI      string             `json:"rootUri"`
-	Capabilities ClientCapabilities `json:"capabilities"`
+	ProtocolVersion string             `json:"protocolVersion"`
+	RootURI         string             `json:"rootUri"`
+	Capabilities    ClientCapabilities `json:"capabilities"`
+	ClientInfo      Implementation     `json:"clientInfo"`
+	AuthToken       string             `json:"authToken,omitempty"`
+}
+
+// InitializeResult represents the result of an initialize request
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
 }
 
 // ClientCapabilities represents the capabilities of an MCP client
@@ -72,6 +112,13 @@ type ClientCapabilities struct {
 	Tools     ToolsClientCapabilities     `json:"tools,omitempty"`
 	Resources ResourcesClientCapabilities `json:"resources,omitempty"`
 	Prompts   PromptsClientCapabilities   `json:"prompts,omitempty"`
+	Sampling  SamplingClientCapabilities  `json:"sampling,omitempty"`
+}
+
+// SamplingClientCapabilities represents whether the client answers
+// sampling requests
+type SamplingClientCapabilities struct {
+	Supported bool `json:"supported"`
 }
 
 // ToolsClientCapabilities represents tool-related capabilities
@@ -98,24 +145,41 @@ type ServerCapabilities struct {
 	Tools     ToolsServerCapabilities     `json:"tools,omitempty"`
 	Resources ResourcesServerCapabilities `json:"resources,omitempty"`
 	Prompts   PromptsServerCapabilities   `json:"prompts,omitempty"`
+	Logging   LoggingServerCapabilities   `json:"logging,omitempty"`
+}
+
+// LoggingServerCapabilities represents whether the server accepts
+// logging/setLevel
+type LoggingServerCapabilities struct {
+	Supported bool `json:"supported"`
 }
 
 // ToolsServerCapabilities represents server tool capabilities
 type ToolsServerCapabilities struct {
-	Supported bool     `json:"supported"`
-	Types     []string `json:"types,omitempty"`
+	Supported   bool     `json:"supported"`
+	Types       []string `json:"types,omitempty"`
+	ListChanged bool     `json:"listChanged,omitempty"`
 }
 
 // ResourcesServerCapabilities represents server resource capabilities
 type ResourcesServerCapabilities struct {
-	Supported bool     `json:"supported"`
-	Types     []string `json:"types,omitempty"`
+	Supported   bool     `json:"supported"`
+	Types       []string `json:"types,omitempty"`
+	ListChanged bool     `json:"listChanged,omitempty"`
+	Subscribe   bool     `json:"subscribe,omitempty"`
 }
 
 // PromptsServerCapabilities represents server prompt capabilities
 type PromptsServerCapabilities struct {
-	Supported bool     `json:"supported"`
-	Types     []string `json:"types,omitempty"`
+	Supported   bool     `json:"supported"`
+	Types       []string `json:"types,omitempty"`
+	ListChanged bool     `json:"listChanged,omitempty"`
+}
+
+// Root represents a root directory or file the client exposes to the server
+type Root struct {
+	URI  string `json:"uri"`
+	Name string `json:"name,omitempty"`
 }
 
 // Tool represents an MCP tool
@@ -124,13 +188,15 @@ type Tool struct {
 	Description string      `json:"description"`
 	Parameters  interface{} `json:"parameters"`
 	Returns     interface{} `json:"returns,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
 }
 
 // ToolCallParams represents parameters for a tool call
 type ToolCallParams struct {
-	Name      string          `json:"name"`
-	Arguments json.RawMessage `json:"arguments"`
-	Timeout   time.Duration   `json:"timeout,omitempty"`
+	Name          string          `json:"name"`
+	Arguments     json.RawMessage `json:"arguments"`
+	Timeout       time.Duration   `json:"timeout,omitempty"`
+	ProgressToken string          `json:"progressToken,omitempty"`
 }
 
 // Resource represents an MCP resource
@@ -139,20 +205,97 @@ type Resource struct {
 	Type        string      `json:"type"`
 	Name        string      `json:"name"`
 	Description string      `json:"description"`
+	MimeType    string      `json:"mimeType,omitempty"`
 	Metadata    interface{} `json:"metadata,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
 }
 
-// Prompt represents an MCP prompt
+// ResourceContents is the content of a resource. Text holds textual content
+// and Blob binary content, which is base64-encoded on the wire.
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     []byte `json:"blob,omitempty"`
+}
+
+// ResourceTemplate describes a family of resources whose URIs are built from
+// an RFC 6570 URI template, such as "db://users/{id}"
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// Prompt represents an MCP prompt. Template and the contents of Messages are
+// text/template templates executed with the arguments, as in {{.topic}}.
+// Messages, when set, take the place of Template, which renders as a single
+// user message. Variables holds default argument values. Templates may only
+// refer to declared Arguments and to Variables.
 type Prompt struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
-	Template    string                 `json:"template"`
+	Template    string                 `json:"template,omitempty"`
+	Messages    []PromptMessage        `json:"messages,omitempty"`
+	Arguments   []PromptArgument       `json:"arguments,omitempty"`
 	Variables   map[string]interface{} `json:"variables,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+}
+
+// PromptArgument declares an argument a prompt accepts
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptMessage is one message of a prompt. Role is RoleSystem, RoleUser or
+// RoleAssistant.
+type PromptMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// PromptRenderParams represents parameters for a prompts/render request
+type PromptRenderParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
 }
 
+// PromptRenderResult is the result of a prompts/render request
+type PromptRenderResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// CancelParams represents parameters for a $/cancelRequest notification
+type CancelParams struct {
+	ID interface{} `json:"id"`
+}
+
+// Notification types carried in NotificationParams.Type
+const (
+	ProgressNotification = "progress"
+	ToolsListChanged     = "tools/list_changed"
+	ResourcesListChanged = "resources/list_changed"
+	PromptsListChanged   = "prompts/list_changed"
+	ResourceUpdated      = "resources/updated"
+	LogNotification      = "log"
+)
+
 // NotificationParams represents parameters for notifications
 type NotificationParams struct {
 	Type    string `json:"type"`
 	Message string `json:"message"`
 	Data    any    `json:"data,omitempty"`
 }
+
+// ProgressParams represents the data of a progress notification. Total is
+// zero when the amount of work is unknown.
+type ProgressParams struct {
+	Token    string  `json:"token"`
+	Progress float64 `json:"progress"`
+	Total    float64 `json:"total,omitempty"`
+}
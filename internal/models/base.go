@@ -126,6 +126,63 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// maxTokensKey is the context key for a per-request completion token limit
+type maxTokensKey struct{}
+
+// WithMaxTokens returns a context that limits Complete and Stream calls made
+// with it to maxTokens completion tokens, below the configured MaxTokens
+func WithMaxTokens(ctx context.Context, maxTokens int) context.Context {
+	return context.WithValue(ctx, maxTokensKey{}, maxTokens)
+}
+
+// maxTokensFor returns the completion token limit for a request, the lower
+// of the configured limit and any set on ctx with WithMaxTokens
+func maxTokensFor(ctx context.Context, configured int) int {
+	limit, ok := ctx.Value(maxTokensKey{}).(int)
+	if !ok || limit <= 0 || (configured > 0 && configured < limit) {
+		return configured
+	}
+	return limit
+}
+
+// temperatureKey is the context key for a per-request sampling temperature
+type temperatureKey struct{}
+
+// WithTemperature returns a context that has Complete and Stream calls made
+// with it sample at temperature instead of the configured Temperature
+func WithTemperature(ctx context.Context, temperature float32) context.Context {
+	return context.WithValue(ctx, temperatureKey{}, temperature)
+}
+
+// temperatureFor returns the sampling temperature for a request, any set on
+// ctx with WithTemperature or else the configured one. It is nil when
+// neither is set, leaving the provider's default.
+func temperatureFor(ctx context.Context, configured float32) *float32 {
+	if temperature, ok := ctx.Value(temperatureKey{}).(float32); ok {
+		return &temperature
+	}
+	if configured == 0 {
+		return nil
+	}
+	return &configured
+}
+
+// stopSequencesKey is the context key for per-request stop sequences
+type stopSequencesKey struct{}
+
+// WithStopSequences returns a context that has Complete and Stream calls
+// made with it end their completion at any of the stop sequences
+func WithStopSequences(ctx context.Context, stop []string) context.Context {
+	return context.WithValue(ctx, stopSequencesKey{}, stop)
+}
+
+// stopSequencesFor returns the stop sequences set on ctx with
+// WithStopSequences, if any
+func stopSequencesFor(ctx context.Context) []string {
+	stop, _ := ctx.Value(stopSequencesKey{}).([]string)
+	return stop
+}
+
 // IModel defines the interface for interacting with AI models
 type IModel interface {
 	// Core methods
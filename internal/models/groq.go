@@ -44,9 +44,10 @@ type GroqRequest struct {
 	Model       string    `json:"model"`
 	Messages    []Message `json:"messages"`
 	Stream      bool      `json:"stream"`
-	Temperature float32   `json:"temperature,omitempty"`
+	Temperature *float32  `json:"temperature,omitempty"`
 	MaxTokens   int       `json:"max_tokens,omitempty"`
 	TopP        float32   `json:"top_p,omitempty"`
+	Stop        []string  `json:"stop,omitempty"`
 }
 
 // GroqResponse represents the response format from Groq API
@@ -71,12 +72,15 @@ func NewGroqModel(config ModelConfig) (*GroqModel, error) {
 		return nil, err
 	}
 
-	return &GroqModel{
+	model := &GroqModel{
 		BaseModel:     base,
 		MCPModelMixin: NewMCPModelMixin(),
 		client:        &http.Client{},
 		apiKey:        config.APIKey,
-	}, nil
+	}
+	// Sampling requests from MCP servers are answered by this model
+	model.MCPModelMixin.model = model
+	return model, nil
 }
 
 // Complete implements IModel
@@ -87,9 +91,10 @@ func (m *GroqModel) Complete(ctx context.Context, messages []Message) (*ModelRes
 		Model:       m.config.ModelID,
 		Messages:    messages,
 		Stream:      false,
-		Temperature: m.config.Temperature,
-		MaxTokens:   m.config.MaxTokens,
+		Temperature: temperatureFor(ctx, m.config.Temperature),
+		MaxTokens:   maxTokensFor(ctx, m.config.MaxTokens),
 		TopP:        m.config.TopP,
+		Stop:        stopSequencesFor(ctx),
 	}
 
 	body, err := sonic.Marshal(req)
@@ -140,9 +145,10 @@ func (m *GroqModel) Stream(ctx context.Context, messages []Message) (<-chan Mode
 		Model:       m.config.ModelID,
 		Messages:    messages,
 		Stream:      true,
-		Temperature: m.config.Temperature,
-		MaxTokens:   m.config.MaxTokens,
+		Temperature: temperatureFor(ctx, m.config.Temperature),
+		MaxTokens:   maxTokensFor(ctx, m.config.MaxTokens),
 		TopP:        m.config.TopP,
+		Stop:        stopSequencesFor(ctx),
 	}
 
 	body, err := sonic.Marshal(req)
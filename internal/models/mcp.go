@@ -22,11 +22,26 @@ package models
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gavinvolpe/nexus/internal/mcp"
 )
 
+const (
+	// mcpShutdownTimeout bounds how long StopMCPServer waits for in-flight requests
+	mcpShutdownTimeout = 10 * time.Second
+	// mcpInitializeTimeout bounds the initialize handshake in ConnectToMCP
+	mcpInitializeTimeout = 30 * time.Second
+	// mcpKeepAliveInterval is how often ConnectToMCP's client pings the server
+	mcpKeepAliveInterval = 30 * time.Second
+)
+
 // IMCPModel extends IModel with MCP capabilities
 type IMCPModel interface {
 	IModel
@@ -34,21 +49,52 @@ type IMCPModel interface {
 	// MCP server capabilities
 	StartMCPServer(addr string) error
 	StopMCPServer() error
-	RegisterMCPTool(tool mcp.Tool) error
+	RegisterMCPTool(tool mcp.Tool, handler mcp.ToolHandler) error
 	RegisterMCPResource(resource mcp.Resource) error
+	RegisterMCPResourceProvider(resourceType string, provider mcp.ResourceProvider) error
 	RegisterMCPPrompt(prompt mcp.Prompt) error
 
 	// MCP client capabilities
 	ConnectToMCP(url string) error
 	DisconnectFromMCP() error
-	CallMCPTool(ctx context.Context, name string, args interface{}) (json.RawMessage, error)
-	ListMCPTools(ctx context.Context) ([]mcp.Tool, error)
+	CallMCPTool(ctx context.Context, name string, args interface{}, opts ...mcp.CallOption) (json.RawMessage, error)
+	ListMCPTools(ctx context.Context, opts ...mcp.ListOption) ([]mcp.Tool, error)
+	ListMCPResources(ctx context.Context, opts ...mcp.ListOption) ([]mcp.Resource, error)
+	ReadMCPResource(ctx context.Context, uri string) (*mcp.ResourceContents, error)
+	WriteMCPResource(ctx context.Context, contents mcp.ResourceContents) error
+	ListMCPPrompts(ctx context.Context, opts ...mcp.ListOption) ([]mcp.Prompt, error)
+	RenderMCPPrompt(ctx context.Context, name string, arguments map[string]interface{}) (*mcp.PromptRenderResult, error)
+	PingMCP(ctx context.Context) error
+	EnableMCPSampling(config SamplingConfig) error
 }
 
 // MCPModelMixin provides MCP capabilities to a model
 type MCPModelMixin struct {
-	server *mcp.Server
-	client *mcp.Client
+	server     *mcp.Server
+	httpServer *http.Server
+	client     *mcp.Client
+
+	// model answers sampling requests; it is the model embedding the mixin
+	model    IModel
+	sampling *SamplingConfig
+	// samplingUsed counts the tokens spent on sampling requests, including
+	// those reserved by requests in progress
+	samplingUsed int
+	samplingMu   sync.Mutex
+}
+
+// SamplingConfig controls how a model answers sampling requests from the
+// MCP servers it connects to
+type SamplingConfig struct {
+	// Approve is asked about every request and declines it by returning
+	// false. Nil approves every request within the token limits.
+	Approve func(ctx context.Context, params mcp.CreateMessageParams) bool
+	// MaxTokensPerRequest caps the completion tokens of each request; 0
+	// leaves the cap to the server and the model's MaxTokens
+	MaxTokensPerRequest int
+	// MaxTotalTokens caps the prompt and completion tokens spent on all
+	// requests together; 0 is unlimited
+	MaxTotalTokens int
 }
 
 // NewMCPModelMixin creates a new MCPModelMixin
@@ -56,34 +102,77 @@ func NewMCPModelMixin() *MCPModelMixin {
 	return &MCPModelMixin{}
 }
 
-// StartMCPServer starts the MCP server
+// StartMCPServer starts the MCP server, serving WebSocket and HTTP+SSE
+// connections on mcp.DefaultPath at addr. It returns once the listener is bound.
 func (m *MCPModelMixin) StartMCPServer(addr string) error {
 	if m.server != nil {
 		return fmt.Errorf("MCP server already running")
 	}
 
-	m.server = mcp.NewServer()
-	// TODO: Start HTTP server with WebSocket upgrade
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", addr, err)
+	}
+
+	// Tools, resources and prompts are registered after the server starts,
+	// so advertise support for them up front
+	server := mcp.NewServer().WithCapabilities(mcp.ServerCapabilities{
+		Tools:     mcp.ToolsServerCapabilities{Supported: true},
+		Resources: mcp.ResourcesServerCapabilities{Supported: true},
+		Prompts:   mcp.PromptsServerCapabilities{Supported: true},
+	})
+	mux := http.NewServeMux()
+	mux.Handle(mcp.DefaultPath, server)
+
+	m.server = server
+	m.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func(httpServer *http.Server) {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("MCP server stopped: %v", err)
+		}
+	}(m.httpServer)
+
 	return nil
 }
 
-// StopMCPServer stops the MCP server
+// StopMCPServer gracefully stops the MCP server, draining in-flight requests
+// before closing client connections
 func (m *MCPModelMixin) StopMCPServer() error {
 	if m.server == nil {
 		return fmt.Errorf("MCP server not running")
 	}
 
-	// TODO: Stop HTTP server
+	ctx, cancel := context.WithTimeout(context.Background(), mcpShutdownTimeout)
+	defer cancel()
+
+	// Drain and close MCP connections before stopping the HTTP server: upgraded
+	// WebSocket connections are not tracked by the HTTP server, and open event
+	// streams would otherwise hold its shutdown until the timeout
+	mcpErr := m.server.Shutdown(ctx)
+	httpErr := m.httpServer.Shutdown(ctx)
+
 	m.server = nil
+	m.httpServer = nil
+
+	if httpErr != nil {
+		return fmt.Errorf("error stopping HTTP server: %w", httpErr)
+	}
+	if mcpErr != nil {
+		return fmt.Errorf("error stopping MCP server: %w", mcpErr)
+	}
 	return nil
 }
 
-// RegisterMCPTool registers a tool with the MCP server
-func (m *MCPModelMixin) RegisterMCPTool(tool mcp.Tool) error {
+// RegisterMCPTool registers a tool and its handler with the MCP server
+func (m *MCPModelMixin) RegisterMCPTool(tool mcp.Tool, handler mcp.ToolHandler) error {
 	if m.server == nil {
 		return fmt.Errorf("MCP server not running")
 	}
-	return m.server.RegisterTool(tool)
+	return m.server.RegisterTool(tool, handler)
 }
 
 // RegisterMCPResource registers a resource with the MCP server
@@ -94,6 +183,14 @@ func (m *MCPModelMixin) RegisterMCPResource(resource mcp.Resource) error {
 	return m.server.RegisterResource(resource)
 }
 
+// RegisterMCPResourceProvider serves the resources of provider from the MCP server
+func (m *MCPModelMixin) RegisterMCPResourceProvider(resourceType string, provider mcp.ResourceProvider) error {
+	if m.server == nil {
+		return fmt.Errorf("MCP server not running")
+	}
+	return m.server.RegisterResourceProvider(resourceType, provider)
+}
+
 // RegisterMCPPrompt registers a prompt with the MCP server
 func (m *MCPModelMixin) RegisterMCPPrompt(prompt mcp.Prompt) error {
 	if m.server == nil {
@@ -124,11 +221,29 @@ func (m *MCPModelMixin) ConnectToMCP(url string) error {
 		},
 	}
 
-	client, err := mcp.NewClient(url, capabilities)
+	client, err := mcp.NewClientWithConfig(url, mcp.ClientConfig{
+		Capabilities: capabilities,
+		Reconnect:    mcp.DefaultReconnectConfig(),
+		KeepAlive:    mcpKeepAliveInterval,
+	})
 	if err != nil {
 		return fmt.Errorf("error connecting to MCP server: %w", err)
 	}
 
+	m.samplingMu.Lock()
+	sampling := m.sampling != nil
+	m.samplingMu.Unlock()
+	if sampling {
+		client.WithSampling(m.handleSampling)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mcpInitializeTimeout)
+	defer cancel()
+	if _, err := client.Initialize(ctx, ""); err != nil {
+		client.Close()
+		return fmt.Errorf("error initializing MCP connection: %w", err)
+	}
+
 	m.client = client
 	return nil
 }
@@ -148,19 +263,196 @@ func (m *MCPModelMixin) DisconnectFromMCP() error {
 }
 
 // CallMCPTool calls a tool on the connected MCP server
-func (m *MCPModelMixin) CallMCPTool(ctx context.Context, name string, args interface{}) (json.RawMessage, error) {
+func (m *MCPModelMixin) CallMCPTool(ctx context.Context, name string, args interface{}, opts ...mcp.CallOption) (json.RawMessage, error) {
 	if m.client == nil {
 		return nil, fmt.Errorf("not connected to MCP server")
 	}
 
-	return m.client.CallTool(ctx, name, args)
+	return m.client.CallTool(ctx, name, args, opts...)
 }
 
 // ListMCPTools lists tools available on the connected MCP server
-func (m *MCPModelMixin) ListMCPTools(ctx context.Context) ([]mcp.Tool, error) {
+func (m *MCPModelMixin) ListMCPTools(ctx context.Context, opts ...mcp.ListOption) ([]mcp.Tool, error) {
 	if m.client == nil {
 		return nil, fmt.Errorf("not connected to MCP server")
 	}
 
-	return m.client.ListTools(ctx)
+	return m.client.ListTools(ctx, opts...)
+}
+
+// ListMCPResources lists resources available on the connected MCP server
+func (m *MCPModelMixin) ListMCPResources(ctx context.Context, opts ...mcp.ListOption) ([]mcp.Resource, error) {
+	if m.client == nil {
+		return nil, fmt.Errorf("not connected to MCP server")
+	}
+
+	return m.client.ListResources(ctx, opts...)
+}
+
+// ReadMCPResource reads a resource from the connected MCP server
+func (m *MCPModelMixin) ReadMCPResource(ctx context.Context, uri string) (*mcp.ResourceContents, error) {
+	if m.client == nil {
+		return nil, fmt.Errorf("not connected to MCP server")
+	}
+
+	return m.client.ReadResource(ctx, uri)
+}
+
+// WriteMCPResource writes a resource on the connected MCP server
+func (m *MCPModelMixin) WriteMCPResource(ctx context.Context, contents mcp.ResourceContents) error {
+	if m.client == nil {
+		return fmt.Errorf("not connected to MCP server")
+	}
+
+	return m.client.WriteResource(ctx, contents)
+}
+
+// ListMCPPrompts lists prompts available on the connected MCP server
+func (m *MCPModelMixin) ListMCPPrompts(ctx context.Context, opts ...mcp.ListOption) ([]mcp.Prompt, error) {
+	if m.client == nil {
+		return nil, fmt.Errorf("not connected to MCP server")
+	}
+
+	return m.client.ListPrompts(ctx, opts...)
+}
+
+// RenderMCPPrompt renders a prompt on the connected MCP server
+func (m *MCPModelMixin) RenderMCPPrompt(ctx context.Context, name string, arguments map[string]interface{}) (*mcp.PromptRenderResult, error) {
+	if m.client == nil {
+		return nil, fmt.Errorf("not connected to MCP server")
+	}
+
+	return m.client.RenderPrompt(ctx, name, arguments)
+}
+
+// PingMCP checks that the connected MCP server is responsive
+func (m *MCPModelMixin) PingMCP(ctx context.Context) error {
+	if m.client == nil {
+		return fmt.Errorf("not connected to MCP server")
+	}
+
+	return m.client.Ping(ctx)
+}
+
+// EnableMCPSampling lets the MCP servers connected to afterwards ask this
+// model for completions, within the limits of config
+func (m *MCPModelMixin) EnableMCPSampling(config SamplingConfig) error {
+	m.samplingMu.Lock()
+	defer m.samplingMu.Unlock()
+
+	if m.model == nil {
+		return fmt.Errorf("no model to answer MCP sampling requests")
+	}
+	m.sampling = &config
+	return nil
+}
+
+// handleSampling answers a sampling request with the embedding model
+func (m *MCPModelMixin) handleSampling(ctx context.Context, params mcp.CreateMessageParams) (*mcp.CreateMessageResult, error) {
+	m.samplingMu.Lock()
+	model, config := m.model, *m.sampling
+	m.samplingMu.Unlock()
+
+	messages, err := samplingMessages(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Approve != nil && !config.Approve(ctx, params) {
+		return nil, mcp.NewError(mcp.CodeRequestDeclined, "sampling request declined by host", nil)
+	}
+
+	maxTokens := params.MaxTokens
+	if config.MaxTokensPerRequest > 0 && (maxTokens <= 0 || maxTokens > config.MaxTokensPerRequest) {
+		maxTokens = config.MaxTokensPerRequest
+	}
+
+	// Models that cannot count tokens are charged their reported usage only
+	promptTokens, err := model.CountTokens(messages)
+	if err != nil {
+		promptTokens = 0
+	}
+	reserved, maxTokens, err := m.reserveSamplingTokens(config, promptTokens, maxTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = WithMaxTokens(ctx, maxTokens)
+	if params.Temperature != nil {
+		ctx = WithTemperature(ctx, *params.Temperature)
+	}
+	if len(params.StopSequences) > 0 {
+		ctx = WithStopSequences(ctx, params.StopSequences)
+	}
+	response, err := model.Complete(ctx, messages)
+	if err != nil {
+		m.settleSamplingTokens(reserved, 0)
+		return nil, fmt.Errorf("error completing sampling request: %w", err)
+	}
+	spent := response.Usage.TotalTokens
+	if spent == 0 {
+		spent = reserved
+	}
+	m.settleSamplingTokens(reserved, spent)
+
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("model returned no choices")
+	}
+	choice := response.Choices[0]
+	return &mcp.CreateMessageResult{
+		Role:       string(RoleAssistant),
+		Content:    choice.Message.Content,
+		Model:      response.Model,
+		StopReason: choice.FinishReason,
+	}, nil
+}
+
+// reserveSamplingTokens sets aside the most a request can spend from the
+// total budget, lowering maxTokens to what remains. It declines the request
+// once the budget cannot cover its prompt.
+func (m *MCPModelMixin) reserveSamplingTokens(config SamplingConfig, promptTokens, maxTokens int) (int, int, error) {
+	m.samplingMu.Lock()
+	defer m.samplingMu.Unlock()
+
+	if config.MaxTotalTokens > 0 {
+		remaining := config.MaxTotalTokens - m.samplingUsed - promptTokens
+		if remaining <= 0 {
+			data := map[string]interface{}{"maxTotalTokens": config.MaxTotalTokens}
+			return 0, 0, mcp.NewError(mcp.CodeRequestDeclined, "sampling token budget exhausted", data)
+		}
+		if maxTokens <= 0 || maxTokens > remaining {
+			maxTokens = remaining
+		}
+	}
+
+	reserved := promptTokens + maxTokens
+	m.samplingUsed += reserved
+	return reserved, maxTokens, nil
+}
+
+// settleSamplingTokens replaces a request's reservation with what it spent
+func (m *MCPModelMixin) settleSamplingTokens(reserved, spent int) {
+	m.samplingMu.Lock()
+	defer m.samplingMu.Unlock()
+	m.samplingUsed += spent - reserved
+}
+
+// samplingMessages converts a sampling request into the model's messages
+func samplingMessages(params mcp.CreateMessageParams) ([]Message, error) {
+	messages := make([]Message, 0, len(params.Messages)+1)
+	if params.SystemPrompt != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: params.SystemPrompt})
+	}
+	for _, msg := range params.Messages {
+		switch ModelRole(msg.Role) {
+		case RoleUser, RoleAssistant:
+		default:
+			return nil, mcp.NewError(mcp.CodeInvalidParams, fmt.Sprintf("unsupported sampling message role %q", msg.Role), nil)
+		}
+		messages = append(messages, Message{Role: ModelRole(msg.Role), Content: msg.Content})
+	}
+	if len(messages) == 0 {
+		return nil, mcp.NewError(mcp.CodeInvalidParams, "sampling request has no messages", nil)
+	}
+	return messages, nil
 }
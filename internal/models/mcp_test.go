@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/gavinvolpe/nexus/internal/mcp"
+)
+
+var errCompletion = errors.New("completion failed")
+
+// fakeModel answers completions without a provider, recording the
+// completion token limit of each
+type fakeModel struct {
+	BaseModel
+	promptTokens int
+	spent        int
+	fail         bool
+	seen         []int
+}
+
+func (m *fakeModel) CountTokens(messages []Message) (int, error) {
+	return m.promptTokens, nil
+}
+
+func (m *fakeModel) Complete(ctx context.Context, messages []Message) (*ModelResponse, error) {
+	m.seen = append(m.seen, maxTokensFor(ctx, 0))
+	if m.fail {
+		return nil, errCompletion
+	}
+	return &ModelResponse{
+		Model:   "fake",
+		Choices: []Choice{{Message: Message{Role: RoleAssistant, Content: "done"}, FinishReason: "stop"}},
+		Usage:   Usage{TotalTokens: m.spent},
+	}, nil
+}
+
+func TestHandleSampling(t *testing.T) {
+	type call struct {
+		maxTokens int
+		wantErr   error
+	}
+
+	tests := []struct {
+		name     string
+		config   SamplingConfig
+		model    *fakeModel
+		calls    []call
+		wantSeen []int
+		wantUsed int
+	}{
+		{
+			name: "declined",
+			config: SamplingConfig{Approve: func(ctx context.Context, params mcp.CreateMessageParams) bool {
+				return false
+			}},
+			model:    &fakeModel{promptTokens: 10},
+			calls:    []call{{maxTokens: 100, wantErr: mcp.ErrRequestDeclined}},
+			wantUsed: 0,
+		},
+		{
+			name:     "per-request cap",
+			config:   SamplingConfig{MaxTokensPerRequest: 50},
+			model:    &fakeModel{promptTokens: 10},
+			calls:    []call{{maxTokens: 200}, {maxTokens: 20}, {maxTokens: 0}},
+			wantSeen: []int{50, 20, 50},
+			// Models that report no usage are charged their reservation
+			wantUsed: 60 + 30 + 60,
+		},
+		{
+			name:     "budget exhausted",
+			config:   SamplingConfig{MaxTotalTokens: 100},
+			model:    &fakeModel{promptTokens: 10, spent: 100},
+			calls:    []call{{maxTokens: 200}, {maxTokens: 10, wantErr: mcp.ErrRequestDeclined}},
+			wantSeen: []int{90},
+			wantUsed: 100,
+		},
+		{
+			name:     "refund on failure",
+			config:   SamplingConfig{MaxTotalTokens: 100},
+			model:    &fakeModel{promptTokens: 10, fail: true},
+			calls:    []call{{maxTokens: 50, wantErr: errCompletion}, {maxTokens: 200, wantErr: errCompletion}},
+			wantSeen: []int{50, 90},
+			wantUsed: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMCPModelMixin()
+			m.model = tt.model
+			if err := m.EnableMCPSampling(tt.config); err != nil {
+				t.Fatalf("EnableMCPSampling() error = %v", err)
+			}
+
+			for i, c := range tt.calls {
+				result, err := m.handleSampling(context.Background(), mcp.CreateMessageParams{
+					Messages:  []mcp.SamplingMessage{{Role: mcp.RoleUser, Content: "Summarize the report"}},
+					MaxTokens: c.maxTokens,
+				})
+				if c.wantErr != nil {
+					if !errors.Is(err, c.wantErr) {
+						t.Errorf("handleSampling() call %d error = %v, want %v", i, err, c.wantErr)
+					}
+					continue
+				}
+				if err != nil || result.Content != "done" {
+					t.Errorf("handleSampling() call %d = %+v, %v, want the completion", i, result, err)
+				}
+			}
+
+			if !slices.Equal(tt.model.seen, tt.wantSeen) {
+				t.Errorf("completion token limits = %v, want %v", tt.model.seen, tt.wantSeen)
+			}
+			if m.samplingUsed != tt.wantUsed {
+				t.Errorf("tokens used = %d, want %d", m.samplingUsed, tt.wantUsed)
+			}
+		})
+	}
+}
@@ -45,6 +45,8 @@ func (m *model) StartMCPServer(addr string) error {
 	if addr == "" {
 		return errors.New("address is required")
 	}
-	// TODO: Implement actual MCP server logic
-	return nil
+	// The MCP server lives in the nexus module (models.MCPModelMixin); this
+	// standalone model cannot serve it, so fail loudly instead of returning
+	// as if a server were running
+	return errors.New("MCP server is not supported by this model; use models.MCPModelMixin")
 }